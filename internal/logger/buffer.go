@@ -0,0 +1,196 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// bufferKey is the context key of a logger's Debug ring buffer
+type bufferKey struct {
+	l *Logger
+}
+
+// bufferedRecord is a suppressed Debug record waiting for an Error
+type bufferedRecord struct {
+	time time.Time
+	msg  string
+}
+
+// debugRing is a bounded ring of suppressed Debug records; when full the
+// oldest record is overwritten
+type debugRing struct {
+	mu      sync.Mutex
+	records []bufferedRecord
+	next    int  // Index of the slot written next
+	full    bool // Whether every slot holds a record
+}
+
+// push adds a record and reports whether an older one was overwritten
+func (r *debugRing) push(rec bufferedRecord) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	overwritten := r.full
+	r.records[r.next] = rec
+	r.next = (r.next + 1) % len(r.records)
+	if r.next == 0 {
+		r.full = true
+	}
+	return overwritten
+}
+
+// drain removes and returns all records, oldest first
+func (r *debugRing) drain() []bufferedRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var out []bufferedRecord
+	if r.full {
+		out = append(out, r.records[r.next:]...)
+	}
+	out = append(out, r.records[:r.next]...)
+
+	r.next = 0
+	r.full = false
+	return out
+}
+
+// BufferContext returns a context in which Debug records suppressed by the
+// current level are kept in a ring buffer of DebugBufferSize entries. They
+// are written, in order and marked with their original time, when
+// ErrorContext is called with the same context, and discarded otherwise.
+// Returns ctx unchanged when buffering is disabled.
+func (l *Logger) BufferContext(ctx context.Context) context.Context {
+	l.mu.Lock()
+	size := l.debugBuffer
+	l.mu.Unlock()
+
+	if size <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, bufferKey{l}, &debugRing{records: make([]bufferedRecord, size)})
+}
+
+// DiscardBuffer drops the Debug records buffered in ctx, e.g. when a job
+// finished successfully
+func (l *Logger) DiscardBuffer(ctx context.Context) {
+	ring, ok := ctx.Value(bufferKey{l}).(*debugRing)
+	if !ok {
+		return
+	}
+
+	dropped := ring.drain()
+	l.mu.Lock()
+	key := metricKey{level: "debug", sink: l.outputType}
+	l.mu.Unlock()
+	for range dropped {
+		l.metrics.addDropped(key)
+	}
+}
+
+// DebugContext logs a debug level message, buffering it in ctx when the
+// current level suppresses Debug
+func (l *Logger) DebugContext(ctx context.Context, format string, v ...interface{}) {
+	l.mu.Lock()
+	if l.level <= DebugLevel {
+		l.log("DEBUG", format, v...)
+		l.mu.Unlock()
+		return
+	}
+	key := metricKey{level: "debug", sink: l.outputType}
+	l.mu.Unlock()
+
+	ring, ok := ctx.Value(bufferKey{l}).(*debugRing)
+	if !ok {
+		return
+	}
+	rec := bufferedRecord{time: time.Now(), msg: fmt.Sprintf(format, v...)}
+	if ring.push(rec) {
+		l.metrics.addDropped(key)
+	}
+}
+
+// InfoContext logs an info level message
+func (l *Logger) InfoContext(ctx context.Context, format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.level > InfoLevel {
+		return
+	}
+	l.log("INFO", format, v...)
+}
+
+// WarnContext logs a warning level message
+func (l *Logger) WarnContext(ctx context.Context, format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.level > WarnLevel {
+		return
+	}
+	l.log("WARN", format, v...)
+}
+
+// ErrorContext writes the Debug records buffered in ctx, then logs an error
+// level message
+func (l *Logger) ErrorContext(ctx context.Context, format string, v ...interface{}) {
+	var buffered []bufferedRecord
+	if ring, ok := ctx.Value(bufferKey{l}).(*debugRing); ok {
+		buffered = ring.drain()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, rec := range buffered {
+		l.log("DEBUG", "(buffered %s) %s", rec.time.Format("2006/01/02 15:04:05.000000"), rec.msg)
+	}
+	if l.level > ErrorLevel {
+		return
+	}
+	l.log("ERROR", format, v...)
+}
+
+// Global logger convenience functions for buffered contexts
+
+// BufferContext returns a buffered context of the global logger
+func BufferContext(ctx context.Context) context.Context {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	if globalLogger != nil {
+		return globalLogger.BufferContext(ctx)
+	}
+	return ctx
+}
+
+func DebugContext(ctx context.Context, format string, v ...interface{}) {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	if globalLogger != nil {
+		globalLogger.DebugContext(ctx, format, v...)
+	}
+}
+
+func InfoContext(ctx context.Context, format string, v ...interface{}) {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	if globalLogger != nil {
+		globalLogger.InfoContext(ctx, format, v...)
+	}
+}
+
+func WarnContext(ctx context.Context, format string, v ...interface{}) {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	if globalLogger != nil {
+		globalLogger.WarnContext(ctx, format, v...)
+	}
+}
+
+func ErrorContext(ctx context.Context, format string, v ...interface{}) {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	if globalLogger != nil {
+		globalLogger.ErrorContext(ctx, format, v...)
+	}
+}
@@ -0,0 +1,102 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestDebugRing tests ring ordering and overwriting
+func TestDebugRing(t *testing.T) {
+	ring := &debugRing{records: make([]bufferedRecord, 3)}
+	for i := 1; i <= 5; i++ {
+		overwritten := ring.push(bufferedRecord{msg: fmt.Sprint(i)})
+		if want := i > 3; overwritten != want {
+			t.Errorf("push(%d) overwritten = %v, want %v", i, overwritten, want)
+		}
+	}
+
+	var got []string
+	for _, rec := range ring.drain() {
+		got = append(got, rec.msg)
+	}
+	if strings.Join(got, ",") != "3,4,5" {
+		t.Errorf("drain() = %v, want oldest first [3 4 5]", got)
+	}
+	if len(ring.drain()) != 0 {
+		t.Error("drain() should empty the ring")
+	}
+}
+
+// TestBufferedDebugFlush tests that buffered Debug records are written on Error only
+func TestBufferedDebugFlush(t *testing.T) {
+	tempDir := t.TempDir()
+	logger, err := New(LoggerConfig{
+		Level:           InfoLevel,
+		OutputType:      "file",
+		LogDir:          tempDir,
+		FilePrefix:      "buffer",
+		DebugBufferSize: 2,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer logger.Close()
+
+	failed := logger.BufferContext(context.Background())
+	succeeded := logger.BufferContext(context.Background())
+
+	logger.DebugContext(failed, "failed step %d", 1)
+	logger.DebugContext(failed, "failed step %d", 2)
+	logger.DebugContext(failed, "failed step %d", 3)
+	logger.DebugContext(succeeded, "succeeded step")
+	logger.DebugContext(context.Background(), "unbuffered step")
+	logger.InfoContext(failed, "job running")
+	logger.ErrorContext(failed, "job failed")
+	logger.ErrorContext(failed, "second error")
+	logger.DiscardBuffer(succeeded)
+	logger.ErrorContext(succeeded, "unrelated error")
+
+	content, err := os.ReadFile(filepath.Join(tempDir, "buffer_"+todayStr()+".log"))
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	contentStr := string(content)
+
+	for _, unwanted := range []string{"failed step 1", "succeeded step", "unbuffered step"} {
+		if strings.Contains(contentStr, unwanted) {
+			t.Errorf("Log should not contain %q", unwanted)
+		}
+	}
+	if strings.Count(contentStr, "failed step 3") != 1 {
+		t.Error("Buffered record should be written exactly once")
+	}
+	step2 := strings.Index(contentStr, "[DEBUG] (buffered ")
+	errIdx := strings.Index(contentStr, "[ERROR] job failed")
+	if step2 < 0 || errIdx < 0 || step2 > errIdx {
+		t.Errorf("Buffered records should precede the error:\n%s", contentStr)
+	}
+
+	var sb strings.Builder
+	logger.WriteMetrics(&sb)
+	if !strings.Contains(sb.String(), `gojob_logger_dropped_records_total{level="debug",sink="file"} 2`) {
+		t.Errorf("Overwritten and discarded records should be counted as dropped:\n%s", sb.String())
+	}
+}
+
+// TestBufferContextDisabled tests that buffering is off without a buffer size
+func TestBufferContextDisabled(t *testing.T) {
+	logger, err := New(LoggerConfig{})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer logger.Close()
+
+	ctx := context.Background()
+	if logger.BufferContext(ctx) != ctx {
+		t.Error("BufferContext should return ctx unchanged when disabled")
+	}
+}
@@ -0,0 +1,228 @@
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Environment variables that override file based configuration
+const (
+	EnvLogLevel         = "GOJOB_LOG_LEVEL"          // debug, info, warn or error
+	EnvLogOutputType    = "GOJOB_LOG_OUTPUT_TYPE"    // console or file
+	EnvLogDir           = "GOJOB_LOG_DIR"            // Directory for log files
+	EnvLogFilePrefix    = "GOJOB_LOG_FILE_PREFIX"    // Prefix for log file names
+	EnvLogRetentionDays = "GOJOB_LOG_RETENTION_DAYS" // Number of days to keep log files
+	EnvLogDebugBuffer   = "GOJOB_LOG_DEBUG_BUFFER"   // Debug records buffered per context
+)
+
+// String returns the lower case name of the level
+func (lv LogLevel) String() string {
+	switch lv {
+	case DebugLevel:
+		return "debug"
+	case InfoLevel:
+		return "info"
+	case WarnLevel:
+		return "warn"
+	case ErrorLevel:
+		return "error"
+	default:
+		return fmt.Sprintf("level(%d)", int(lv))
+	}
+}
+
+// ParseLevel converts a level name ("debug", "info", "warn", "error") or its
+// numeric value into a LogLevel
+func ParseLevel(s string) (LogLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return DebugLevel, nil
+	case "info":
+		return InfoLevel, nil
+	case "warn", "warning":
+		return WarnLevel, nil
+	case "error":
+		return ErrorLevel, nil
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || LogLevel(n) < DebugLevel || LogLevel(n) > ErrorLevel {
+		return 0, fmt.Errorf("invalid log level: %q. Must be one of debug, info, warn, error", s)
+	}
+	return LogLevel(n), nil
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (lv LogLevel) MarshalText() ([]byte, error) {
+	return []byte(lv.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler so levels can be written
+// by name in YAML and TOML files
+func (lv *LogLevel) UnmarshalText(text []byte) error {
+	level, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*lv = level
+	return nil
+}
+
+// Validate checks the configuration without modifying it. Empty output type
+// and retention days are valid and replaced by defaults when applied.
+func (c LoggerConfig) Validate() error {
+	if c.Level < DebugLevel || c.Level > ErrorLevel {
+		return fmt.Errorf("invalid log level: %d", int(c.Level))
+	}
+
+	// Validate output type
+	if c.OutputType != "" && c.OutputType != "console" && c.OutputType != "file" {
+		return fmt.Errorf("invalid output type: %s. Must be 'console' or 'file'", c.OutputType)
+	}
+
+	if c.RetentionDays < 0 {
+		return fmt.Errorf("invalid retention days: %d. Must not be negative", c.RetentionDays)
+	}
+
+	if c.DebugBufferSize < 0 {
+		return fmt.Errorf("invalid debug buffer size: %d. Must not be negative", c.DebugBufferSize)
+	}
+
+	// Validate file configuration if needed
+	if c.OutputType == "file" {
+		if c.LogDir == "" {
+			return errors.New("log directory is required for file output")
+		}
+		if c.FilePrefix == "" {
+			return errors.New("file prefix is required for file output")
+		}
+	}
+	return nil
+}
+
+// prepare fills in defaults, validates the configuration and creates the log
+// directory for file output
+func (c *LoggerConfig) prepare() error {
+	// Set default output type if not specified
+	if c.OutputType == "" {
+		c.OutputType = "console"
+	}
+
+	// Set default retention days if not specified
+	if c.RetentionDays <= 0 {
+		c.RetentionDays = 7
+	}
+
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	if c.OutputType == "file" {
+		// Create log directory if it doesn't exist
+		if err := os.MkdirAll(c.LogDir, 0755); err != nil {
+			return fmt.Errorf("failed to create log directory: %v", err)
+		}
+	}
+	return nil
+}
+
+// LoadConfig reads a logger configuration from a YAML (.yaml, .yml) or TOML
+// (.toml) file and applies GOJOB_LOG_* environment overrides on top of it.
+// An empty path loads the configuration from the environment only.
+// Args:
+//   - path: Configuration file path (optional)
+//
+// Returns:
+//   - LoggerConfig: The merged and validated configuration
+//   - error:        Read, parse or validation errors
+func LoadConfig(path string) (LoggerConfig, error) {
+	var config LoggerConfig
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return config, fmt.Errorf("failed to read logger config: %w", err)
+		}
+		if config, err = parseConfig(path, data); err != nil {
+			return config, err
+		}
+	}
+
+	config, err := ApplyEnv(config)
+	if err != nil {
+		return config, err
+	}
+
+	if err := config.Validate(); err != nil {
+		return config, fmt.Errorf("invalid logger config: %w", err)
+	}
+	return config, nil
+}
+
+// parseConfig decodes data according to the file extension of path
+func parseConfig(path string, data []byte) (LoggerConfig, error) {
+	var config LoggerConfig
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+			return config, fmt.Errorf("failed to parse YAML logger config %s: %w", path, err)
+		}
+	case ".toml":
+		dec := toml.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&config); err != nil {
+			return config, fmt.Errorf("failed to parse TOML logger config %s: %w", path, err)
+		}
+	default:
+		return config, fmt.Errorf("unsupported logger config format %q: use .yaml, .yml or .toml", ext)
+	}
+	return config, nil
+}
+
+// ApplyEnv overrides fields of config with any GOJOB_LOG_* environment
+// variables that are set
+func ApplyEnv(config LoggerConfig) (LoggerConfig, error) {
+	if v, ok := os.LookupEnv(EnvLogLevel); ok {
+		level, err := ParseLevel(v)
+		if err != nil {
+			return config, fmt.Errorf("%s: %w", EnvLogLevel, err)
+		}
+		config.Level = level
+	}
+	if v, ok := os.LookupEnv(EnvLogOutputType); ok {
+		config.OutputType = strings.TrimSpace(v)
+	}
+	if v, ok := os.LookupEnv(EnvLogDir); ok {
+		config.LogDir = v
+	}
+	if v, ok := os.LookupEnv(EnvLogFilePrefix); ok {
+		config.FilePrefix = v
+	}
+	if v, ok := os.LookupEnv(EnvLogRetentionDays); ok {
+		days, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return config, fmt.Errorf("%s: invalid retention days %q: %w", EnvLogRetentionDays, v, err)
+		}
+		config.RetentionDays = days
+	}
+	if v, ok := os.LookupEnv(EnvLogDebugBuffer); ok {
+		size, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return config, fmt.Errorf("%s: invalid debug buffer size %q: %w", EnvLogDebugBuffer, v, err)
+		}
+		config.DebugBufferSize = size
+	}
+	return config, nil
+}
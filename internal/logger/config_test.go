@@ -0,0 +1,198 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestParseLevel tests level name and number parsing
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    LogLevel
+		wantErr bool
+	}{
+		{"debug", DebugLevel, false},
+		{"INFO", InfoLevel, false},
+		{"warning", WarnLevel, false},
+		{" error ", ErrorLevel, false},
+		{"2", WarnLevel, false},
+		{"7", 0, true},
+		{"verbose", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseLevel(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLevel(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLevel(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+// TestLoadConfigFormats tests loading YAML and TOML configuration files
+func TestLoadConfigFormats(t *testing.T) {
+	tempDir := t.TempDir()
+	want := LoggerConfig{
+		Level:         WarnLevel,
+		OutputType:    "file",
+		LogDir:        "/var/log/go-job",
+		FilePrefix:    "job",
+		RetentionDays: 3,
+	}
+
+	files := map[string]string{
+		"logger.yaml": "level: warn\noutput_type: file\nlog_dir: /var/log/go-job\nfile_prefix: job\nretention_days: 3\n",
+		"logger.toml": "level = \"warn\"\noutput_type = \"file\"\nlog_dir = \"/var/log/go-job\"\nfile_prefix = \"job\"\nretention_days = 3\n",
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(tempDir, name)
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatalf("Failed to write config: %v", err)
+			}
+
+			got, err := LoadConfig(path)
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+			if got != want {
+				t.Errorf("LoadConfig() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+// TestLoadConfigErrors tests that invalid files produce descriptive errors
+func TestLoadConfigErrors(t *testing.T) {
+	tempDir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr string
+	}{
+		{"unknown field", "bad.yaml", "levle: info\n", "field levle not found"},
+		{"invalid level", "bad.toml", "level = \"loud\"\n", "invalid log level"},
+		{"invalid output", "bad.yml", "output_type: syslog\n", "invalid output type: syslog"},
+		{"missing dir", "bad2.yaml", "output_type: file\nfile_prefix: x\n", "log directory is required"},
+		{"unsupported format", "bad.json", "{}", "unsupported logger config format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tempDir, tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to write config: %v", err)
+			}
+
+			_, err := LoadConfig(path)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadConfig() error = %v, want substring %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestLoadConfigEnv tests that environment variables override file values
+func TestLoadConfigEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logger.yaml")
+	if err := os.WriteFile(path, []byte("level: info\nretention_days: 3\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	t.Setenv(EnvLogLevel, "debug")
+	t.Setenv(EnvLogRetentionDays, "10")
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if config.Level != DebugLevel || config.RetentionDays != 10 {
+		t.Errorf("Environment overrides not applied: %+v", config)
+	}
+
+	t.Setenv(EnvLogRetentionDays, "ten")
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), EnvLogRetentionDays) {
+		t.Errorf("Expected error naming %s, got %v", EnvLogRetentionDays, err)
+	}
+}
+
+// TestReconfigure tests switching level and sink on a running logger
+func TestReconfigure(t *testing.T) {
+	ResetGlobalLogger()
+	tempDir := t.TempDir()
+
+	logger, err := InitGlobalLogger(LoggerConfig{Level: ErrorLevel})
+	if err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+	defer ResetGlobalLogger()
+
+	err = logger.Reconfigure(LoggerConfig{
+		Level:      DebugLevel,
+		OutputType: "file",
+		LogDir:     tempDir,
+		FilePrefix: "reconf",
+	})
+	if err != nil {
+		t.Fatalf("Reconfigure() error = %v", err)
+	}
+	logger.Debug("Debug after reconfigure")
+
+	logFile := filepath.Join(tempDir, "reconf_"+todayStr()+".log")
+	content, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	if !strings.Contains(string(content), "Debug after reconfigure") {
+		t.Error("Debug message should be written to the new file sink")
+	}
+
+	if got := logger.Config(); got.RetentionDays != 7 || got.OutputType != "file" {
+		t.Errorf("Unexpected config after reconfigure: %+v", got)
+	}
+
+	// Invalid configuration must leave the logger untouched
+	if err := logger.Reconfigure(LoggerConfig{OutputType: "file"}); err == nil {
+		t.Error("Reconfigure with missing directory should return error")
+	}
+	if got := logger.Config(); got.LogDir != tempDir {
+		t.Errorf("Failed reconfigure changed log dir to %q", got.LogDir)
+	}
+
+	// A log file that cannot be opened must leave the logger untouched too
+	before := logger.Config()
+	if err := os.Mkdir(filepath.Join(tempDir, "broken_"+todayStr()+".log"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	err = logger.Reconfigure(LoggerConfig{
+		Level:           WarnLevel,
+		OutputType:      "file",
+		LogDir:          tempDir,
+		FilePrefix:      "broken",
+		RetentionDays:   30,
+		DebugBufferSize: 5,
+	})
+	if err == nil {
+		t.Error("Reconfigure with unopenable log file should return error")
+	}
+	if got := logger.Config(); got != before {
+		t.Errorf("Failed reconfigure changed config to %+v, want %+v", got, before)
+	}
+	logger.Debug("Debug after failed reconfigure")
+	content, err = os.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	if !strings.Contains(string(content), "Debug after failed reconfigure") {
+		t.Error("Debug message should still be written to the previous sink")
+	}
+}
@@ -0,0 +1,75 @@
+package logger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Field is a key/value pair attached to a structured log record
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F creates a Field
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Log writes msg followed by the fields as key=value pairs, e.g.
+// "[INFO] request method=GET path=/jobs status=200"
+func (l *Logger) Log(level LogLevel, msg string, fields ...Field) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.level > level {
+		return
+	}
+	l.log(strings.ToUpper(level.String()), "%s", formatFields(msg, fields))
+}
+
+// Log writes a structured record through the global logger
+func Log(level LogLevel, msg string, fields ...Field) {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	if globalLogger != nil {
+		globalLogger.Log(level, msg, fields...)
+	}
+}
+
+// formatFields renders msg and fields in logfmt style
+func formatFields(msg string, fields []Field) string {
+	var sb strings.Builder
+	sb.WriteString(msg)
+	for _, f := range fields {
+		sb.WriteByte(' ')
+		sb.WriteString(f.Key)
+		sb.WriteByte('=')
+		sb.WriteString(formatValue(f.Value))
+	}
+	return sb.String()
+}
+
+// formatValue renders a field value, quoting it when it would be ambiguous
+func formatValue(v interface{}) string {
+	var s string
+	switch val := v.(type) {
+	case nil:
+		return "<nil>"
+	case string:
+		s = val
+	case time.Duration:
+		s = val.String()
+	case error:
+		s = val.Error()
+	case fmt.Stringer:
+		s = val.String()
+	default:
+		s = fmt.Sprint(val)
+	}
+	if s == "" || strings.ContainsAny(s, " =\"\t\n\r") {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,50 @@
+package logger
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestFormatFields tests logfmt rendering and quoting of field values
+func TestFormatFields(t *testing.T) {
+	got := formatFields("request", []Field{
+		F("method", "GET"),
+		F("status", 200),
+		F("latency", 1500*time.Microsecond),
+		F("error", errors.New("not found")),
+		F("empty", ""),
+		F("nothing", nil),
+	})
+	want := `request method=GET status=200 latency=1.5ms error="not found" empty="" nothing=<nil>`
+	if got != want {
+		t.Errorf("formatFields() = %q, want %q", got, want)
+	}
+}
+
+// TestLogFields tests level filtering of structured records
+func TestLogFields(t *testing.T) {
+	tempDir := t.TempDir()
+	logger, err := New(LoggerConfig{Level: WarnLevel, OutputType: "file", LogDir: tempDir, FilePrefix: "fields"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer logger.Close()
+
+	logger.Log(InfoLevel, "filtered", F("k", "v"))
+	logger.Log(ErrorLevel, "job failed", F("job", "backup"), F("code", 2))
+
+	content, err := os.ReadFile(filepath.Join(tempDir, "fields_"+todayStr()+".log"))
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	if strings.Contains(string(content), "filtered") {
+		t.Error("Info record should not be output at Warn level")
+	}
+	if !strings.Contains(string(content), "[ERROR] job failed job=backup code=2") {
+		t.Errorf("Unexpected log content: %s", content)
+	}
+}
@@ -2,8 +2,8 @@ package logger
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
@@ -26,11 +26,12 @@ const (
 
 // LoggerConfig contains configuration options for the logger
 type LoggerConfig struct {
-	Level         LogLevel // Minimum level to log
-	OutputType    string   // "console" or "file"
-	LogDir        string   // Directory for log files (required for file output)
-	FilePrefix    string   // Prefix for log file names (required for file output)
-	RetentionDays int      // Number of days to keep log files (default: 7)
+	Level           LogLevel `yaml:"level" toml:"level"`                         // Minimum level to log
+	OutputType      string   `yaml:"output_type" toml:"output_type"`             // "console" or "file"
+	LogDir          string   `yaml:"log_dir" toml:"log_dir"`                     // Directory for log files (required for file output)
+	FilePrefix      string   `yaml:"file_prefix" toml:"file_prefix"`             // Prefix for log file names (required for file output)
+	RetentionDays   int      `yaml:"retention_days" toml:"retention_days"`       // Number of days to keep log files (default: 7)
+	DebugBufferSize int      `yaml:"debug_buffer_size" toml:"debug_buffer_size"` // Debug records buffered per context until an Error (0 disables)
 }
 
 // Logger represents a logging instance
@@ -40,9 +41,14 @@ type Logger struct {
 	outputType    string
 	logDir        string
 	filePrefix    string
+	fileName      string // Fixed file name that disables daily rotation (optional)
 	retentionDays int
-	logger        *log.Logger // Single logger instance
+	debugBuffer   int             // Capacity of per-context Debug ring buffers
+	logger        *log.Logger     // Single logger instance
+	out           *countingWriter // Sink of logger, counts bytes per record
+	metrics       *loggerMetrics  // Self-metrics exposed in Prometheus format
 	currentFile   *os.File
+	rotating      bool               // Whether the daily rotation goroutine is running
 	ctx           context.Context    // Context for managing goroutine lifecycle
 	cancel        context.CancelFunc // Cancel function to stop goroutines
 }
@@ -52,43 +58,40 @@ var (
 	globalMu     sync.Mutex
 )
 
-// InitGlobalLogger initializes the global logger with the provided configuration
+// InitGlobalLogger initializes the global logger with the provided configuration.
+// If the global logger already exists it is reconfigured when config differs
+// from the running configuration, and the same instance is returned.
 func InitGlobalLogger(config LoggerConfig) (*Logger, error) {
 	globalMu.Lock()
 	defer globalMu.Unlock()
 
 	if globalLogger != nil {
+		if err := config.prepare(); err != nil {
+			return nil, err
+		}
+		if config != globalLogger.Config() {
+			if err := globalLogger.Reconfigure(config); err != nil {
+				return nil, err
+			}
+		}
 		return globalLogger, nil
 	}
 
-	// Set default output type if not specified
-	if config.OutputType == "" {
-		config.OutputType = "console"
-	}
-
-	// Validate output type
-	if config.OutputType != "console" && config.OutputType != "file" {
-		return nil, fmt.Errorf("invalid output type: %s. Must be 'console' or 'file'", config.OutputType)
-	}
-
-	// Set default retention days if not specified
-	if config.RetentionDays <= 0 {
-		config.RetentionDays = 7
+	logger, err := New(config)
+	if err != nil {
+		return nil, err
 	}
 
-	// Validate file configuration if needed
-	if config.OutputType == "file" {
-		if config.LogDir == "" {
-			return nil, errors.New("log directory is required for file output")
-		}
-		if config.FilePrefix == "" {
-			return nil, errors.New("file prefix is required for file output")
-		}
+	globalLogger = logger
+	return logger, nil
+}
 
-		// Create log directory if it doesn't exist
-		if err := os.MkdirAll(config.LogDir, 0755); err != nil {
-			return nil, fmt.Errorf("failed to create log directory: %v", err)
-		}
+// New creates a standalone logger that is independent of the global one.
+// Each instance owns its file handle and rotation goroutine, and must be
+// released with Close.
+func New(config LoggerConfig) (*Logger, error) {
+	if err := config.prepare(); err != nil {
+		return nil, err
 	}
 
 	// Create context for managing goroutine lifecycle
@@ -101,13 +104,15 @@ func InitGlobalLogger(config LoggerConfig) (*Logger, error) {
 		logDir:        config.LogDir,
 		filePrefix:    config.FilePrefix,
 		retentionDays: config.RetentionDays,
+		debugBuffer:   config.DebugBufferSize,
+		metrics:       newLoggerMetrics(),
 		ctx:           ctx,
 		cancel:        cancel,
 	}
 
 	// Initialize logger based on output type
 	if config.OutputType == "console" {
-		logger.logger = log.New(os.Stdout, "", log.Ldate|log.Ltime|log.Lmicroseconds|log.Lshortfile)
+		logger.setOutput(os.Stdout)
 	} else if config.OutputType == "file" {
 		if err := logger.setupFileLogger(); err != nil {
 			cancel() // Cleanup if initialization fails
@@ -119,12 +124,11 @@ func InitGlobalLogger(config LoggerConfig) (*Logger, error) {
 
 		// Clean up old logs immediately on initialization
 		if err := logger.cleanupOldLogs(); err != nil {
-			cancel() // Cleanup if cleanup fails
+			logger.Close() // Cleanup if cleanup fails
 			return nil, fmt.Errorf("failed to clean up old logs: %v", err)
 		}
 	}
 
-	globalLogger = logger
 	return logger, nil
 }
 
@@ -132,33 +136,53 @@ func InitGlobalLogger(config LoggerConfig) (*Logger, error) {
 func (l *Logger) setupFileLogger() error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
+	return l.openLogFile()
+}
 
-	// Close current file if it exists
-	if l.currentFile != nil {
-		if err := l.currentFile.Close(); err != nil {
-			log.Printf("Warning: failed to close log file: %v", err)
-		}
-		l.currentFile = nil
+// openLogFile opens today's log file and swaps it in; the caller must hold l.mu
+func (l *Logger) openLogFile() error {
+	// Open the new file first so a failure keeps the current sink usable
+	filename := l.fileName
+	if filename == "" {
+		dateStr := time.Now().Format("2006-01-02")
+		filename = fmt.Sprintf("%s_%s.log", l.filePrefix, dateStr)
 	}
-
-	// Create log file name with current date
-	dateStr := time.Now().Format("2006-01-02")
-	filename := fmt.Sprintf("%s_%s.log", l.filePrefix, dateStr)
 	filePath := filepath.Join(l.logDir, filename)
 
-	// Open log file in append mode
 	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to open log file: %v", err)
 	}
 
+	// Close current file if it exists
+	if l.currentFile != nil {
+		if err := l.currentFile.Close(); err != nil {
+			log.Printf("Warning: failed to close log file: %v", err)
+		}
+		l.currentFile = nil
+	}
+
 	l.currentFile = file
-	l.logger = log.New(file, "", log.Ldate|log.Ltime|log.Lmicroseconds|log.Lshortfile)
+	l.setOutput(file)
 	return nil
 }
 
+// setOutput points the logger at w through a byte counter; the caller must hold l.mu
+func (l *Logger) setOutput(w io.Writer) {
+	l.out = &countingWriter{w: w}
+	l.logger = log.New(l.out, "", log.Ldate|log.Ltime|log.Lmicroseconds|log.Lshortfile)
+}
+
 // scheduleDailyTasks sets up daily log rotation in a separate goroutine
 func (l *Logger) scheduleDailyTasks() {
+	l.mu.Lock()
+	if l.rotating {
+		l.mu.Unlock()
+		return
+	}
+	l.rotating = true
+	l.mu.Unlock()
+
 	// Calculate time until next midnight
 	now := time.Now()
 	nextMidnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
@@ -183,9 +207,18 @@ func (l *Logger) scheduleDailyTasks() {
 
 // rotateAndCleanup handles log rotation and old log cleanup
 func (l *Logger) rotateAndCleanup() {
+	l.mu.Lock()
+	isFile := l.outputType == "file"
+	l.mu.Unlock()
+	if !isFile {
+		return // Output was switched to console by a reconfiguration
+	}
+
 	// Rotate log file
 	if err := l.setupFileLogger(); err != nil {
 		log.Printf("Error rotating log file: %v", err)
+	} else {
+		l.metrics.addRotation()
 	}
 
 	// Clean up old logs
@@ -196,14 +229,19 @@ func (l *Logger) rotateAndCleanup() {
 
 // cleanupOldLogs removes log files older than retentionDays
 func (l *Logger) cleanupOldLogs() error {
-	files, err := os.ReadDir(l.logDir)
+	// Snapshot the settings a concurrent Reconfigure may change
+	l.mu.Lock()
+	logDir, filePrefix, retentionDays := l.logDir, l.filePrefix, l.retentionDays
+	l.mu.Unlock()
+
+	files, err := os.ReadDir(logDir)
 	if err != nil {
 		return fmt.Errorf("failed to read log directory: %v", err)
 	}
 
 	now := time.Now()
-	cutoffTime := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, -l.retentionDays)
-	prefix := l.filePrefix + "_"
+	cutoffTime := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, -retentionDays)
+	prefix := filePrefix + "_"
 	suffix := ".log"
 
 	var oldFiles []string
@@ -228,18 +266,21 @@ func (l *Logger) cleanupOldLogs() error {
 
 	// Sort old files by age
 	sort.Slice(oldFiles, func(i, j int) bool {
-		fileI, _ := os.Stat(filepath.Join(l.logDir, oldFiles[i]))
-		fileJ, _ := os.Stat(filepath.Join(l.logDir, oldFiles[j]))
+		fileI, _ := os.Stat(filepath.Join(logDir, oldFiles[i]))
+		fileJ, _ := os.Stat(filepath.Join(logDir, oldFiles[j]))
 		return fileI.ModTime().Before(fileJ.ModTime())
 	})
 
 	// Delete old files
 	for _, file := range oldFiles {
-		filePath := filepath.Join(l.logDir, file)
+		filePath := filepath.Join(logDir, file)
 		if err := os.Remove(filePath); err != nil {
 			log.Printf("Warning: failed to delete old log file %s: %v", filePath, err)
 		} else {
+			l.metrics.addDeletedFile()
+			l.mu.Lock()
 			l.log("INFO", "Deleted old log file: %s", filePath)
+			l.mu.Unlock()
 		}
 	}
 
@@ -247,51 +288,58 @@ func (l *Logger) cleanupOldLogs() error {
 }
 
 // log writes a message with the specified level
+// and records its metrics; the caller must hold l.mu
 func (l *Logger) log(level string, format string, v ...interface{}) {
+	key := metricKey{level: strings.ToLower(level), sink: l.outputType}
 	if l.logger == nil {
+		l.metrics.addDropped(key)
 		return
 	}
 	msg := fmt.Sprintf("[%s] "+format, append([]interface{}{level}, v...)...)
-	l.logger.Output(4, msg)
+
+	l.out.n = 0
+	start := time.Now()
+	err := l.logger.Output(4, msg)
+	l.metrics.addWrite(key, l.out.n, time.Since(start), err)
 }
 
 // Debug logs a debug level message
 func (l *Logger) Debug(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	if l.level > DebugLevel {
 		return
 	}
-	l.mu.Lock()
-	defer l.mu.Unlock()
 	l.log("DEBUG", format, v...)
 }
 
 // Info logs an info level message
 func (l *Logger) Info(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	if l.level > InfoLevel {
 		return
 	}
-	l.mu.Lock()
-	defer l.mu.Unlock()
 	l.log("INFO", format, v...)
 }
 
 // Warn logs a warning level message
 func (l *Logger) Warn(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	if l.level > WarnLevel {
 		return
 	}
-	l.mu.Lock()
-	defer l.mu.Unlock()
 	l.log("WARN", format, v...)
 }
 
 // Error logs an error level message
 func (l *Logger) Error(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	if l.level > ErrorLevel {
 		return
 	}
-	l.mu.Lock()
-	defer l.mu.Unlock()
 	l.log("ERROR", format, v...)
 }
 
@@ -302,6 +350,83 @@ func (l *Logger) SetLevel(level LogLevel) {
 	l.level = level
 }
 
+// Reconfigure applies a new configuration to a running logger. Level and
+// retention take effect immediately; a changed output type, directory or
+// prefix switches the sink without losing records.
+func (l *Logger) Reconfigure(config LoggerConfig) error {
+	if err := config.prepare(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	sinkChanged := l.outputType != config.OutputType ||
+		l.logDir != config.LogDir ||
+		l.filePrefix != config.FilePrefix ||
+		l.logger == nil
+	old := *l.configLocked()
+
+	l.level = config.Level
+	l.retentionDays = config.RetentionDays
+	l.debugBuffer = config.DebugBufferSize
+	l.outputType = config.OutputType
+	l.logDir = config.LogDir
+	l.filePrefix = config.FilePrefix
+
+	if sinkChanged {
+		var err error
+		if config.OutputType == "file" {
+			err = l.openLogFile()
+		} else {
+			if l.currentFile != nil {
+				if err := l.currentFile.Close(); err != nil {
+					log.Printf("Warning: failed to close log file: %v", err)
+				}
+				l.currentFile = nil
+			}
+			l.setOutput(os.Stdout)
+		}
+		if err != nil {
+			// Keep running with the previous configuration and sink
+			l.level = old.Level
+			l.retentionDays = old.RetentionDays
+			l.debugBuffer = old.DebugBufferSize
+			l.outputType = old.OutputType
+			l.logDir = old.LogDir
+			l.filePrefix = old.FilePrefix
+			l.mu.Unlock()
+			return err
+		}
+	}
+	l.mu.Unlock()
+
+	if config.OutputType == "file" {
+		l.scheduleDailyTasks()
+		if err := l.cleanupOldLogs(); err != nil {
+			return fmt.Errorf("failed to clean up old logs: %v", err)
+		}
+	}
+	return nil
+}
+
+// Config returns the configuration the logger is currently running with
+func (l *Logger) Config() LoggerConfig {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return *l.configLocked()
+}
+
+// configLocked snapshots the current configuration; the caller must hold l.mu
+func (l *Logger) configLocked() *LoggerConfig {
+	return &LoggerConfig{
+		Level:           l.level,
+		OutputType:      l.outputType,
+		LogDir:          l.logDir,
+		FilePrefix:      l.filePrefix,
+		RetentionDays:   l.retentionDays,
+		DebugBufferSize: l.debugBuffer,
+	}
+}
+
 // Close cleans up resources and stops all goroutines
 func (l *Logger) Close() {
 	l.mu.Lock()
@@ -317,6 +442,10 @@ func (l *Logger) Close() {
 		}
 		l.currentFile = nil
 	}
+
+	// Records logged after closing are counted as dropped
+	l.logger = nil
+	l.out = nil
 }
 
 // GetLogger returns the global logger instance
@@ -284,3 +284,78 @@ func TestClose(t *testing.T) {
 		t.Error("Global logger should not be nil after closing")
 	}
 }
+
+// TestNewIndependentLoggers tests standalone loggers alongside the global one
+func TestNewIndependentLoggers(t *testing.T) {
+	ResetGlobalLogger()
+	defer ResetGlobalLogger()
+	dirA := t.TempDir()
+	dirB := t.TempDir()
+
+	global, err := InitGlobalLogger(LoggerConfig{})
+	if err != nil {
+		t.Fatalf("Failed to initialize global logger: %v", err)
+	}
+
+	loggerA, err := New(LoggerConfig{OutputType: "file", LogDir: dirA, FilePrefix: "run"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	loggerB, err := New(LoggerConfig{OutputType: "file", LogDir: dirB, FilePrefix: "run"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer loggerB.Close()
+
+	if loggerA == global || loggerA == loggerB {
+		t.Fatal("New should return distinct instances")
+	}
+	if GetLogger() != global {
+		t.Error("New must not replace the global logger")
+	}
+
+	loggerA.Info("Message for A")
+	loggerB.Info("Message for B")
+
+	// Closing one instance must not affect the other
+	loggerA.Close()
+	loggerB.Info("Second message for B")
+
+	content, err := os.ReadFile(filepath.Join(dirB, "run_"+todayStr()+".log"))
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	contentStr := string(content)
+	if strings.Contains(contentStr, "Message for A") {
+		t.Error("Logger B should not contain messages of logger A")
+	}
+	if !strings.Contains(contentStr, "Second message for B") {
+		t.Error("Logger B should keep writing after logger A is closed")
+	}
+
+	if _, err := New(LoggerConfig{OutputType: "invalid"}); err == nil {
+		t.Error("New with invalid output type should return error")
+	}
+}
+
+// TestInitGlobalLoggerReconfigures tests re-initialization with a new config
+func TestInitGlobalLoggerReconfigures(t *testing.T) {
+	ResetGlobalLogger()
+	defer ResetGlobalLogger()
+
+	logger1, err := InitGlobalLogger(LoggerConfig{Level: InfoLevel})
+	if err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+
+	logger2, err := InitGlobalLogger(LoggerConfig{Level: ErrorLevel})
+	if err != nil {
+		t.Fatalf("Failed to re-initialize logger: %v", err)
+	}
+	if logger1 != logger2 {
+		t.Error("Re-initialization should return the same instance")
+	}
+	if got := logger2.Config().Level; got != ErrorLevel {
+		t.Errorf("Level = %v, want error after re-initialization", got)
+	}
+}
@@ -0,0 +1,186 @@
+package logger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// writeDurationBuckets are the upper bounds (in seconds) of the write latency histogram
+var writeDurationBuckets = []float64{0.00001, 0.00005, 0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5}
+
+// metricKey identifies a series by level and sink
+type metricKey struct {
+	level string // "debug", "info", "warn", "error" or "output" for raw writes
+	sink  string // "console" or "file"
+}
+
+// histogram is a cumulative Prometheus style histogram
+type histogram struct {
+	counts []uint64 // Per bucket counts, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// loggerMetrics holds the self-metrics of a Logger
+type loggerMetrics struct {
+	mu           sync.Mutex
+	records      map[metricKey]uint64
+	bytes        map[metricKey]uint64
+	writeErrors  map[metricKey]uint64
+	dropped      map[metricKey]uint64
+	durations    map[metricKey]*histogram
+	rotations    uint64
+	deletedFiles uint64
+}
+
+// countingWriter remembers how many bytes the last records wrote
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+// Write implements io.Writer
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += n
+	return n, err
+}
+
+// newLoggerMetrics creates an empty metrics set
+func newLoggerMetrics() *loggerMetrics {
+	return &loggerMetrics{
+		records:     make(map[metricKey]uint64),
+		bytes:       make(map[metricKey]uint64),
+		writeErrors: make(map[metricKey]uint64),
+		dropped:     make(map[metricKey]uint64),
+		durations:   make(map[metricKey]*histogram),
+	}
+}
+
+// addWrite records the outcome of writing one record to a sink
+func (m *loggerMetrics) addWrite(key metricKey, n int, d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err != nil {
+		m.writeErrors[key]++
+	} else {
+		m.records[key]++
+	}
+	m.bytes[key] += uint64(n)
+
+	h := m.durations[key]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(writeDurationBuckets))}
+		m.durations[key] = h
+	}
+	seconds := d.Seconds()
+	for i, bound := range writeDurationBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// addDropped records a record that was discarded without being written
+func (m *loggerMetrics) addDropped(key metricKey) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dropped[key]++
+}
+
+// addRotation records a completed log file rotation
+func (m *loggerMetrics) addRotation() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rotations++
+}
+
+// addDeletedFile records an old log file removed by retention
+func (m *loggerMetrics) addDeletedFile() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deletedFiles++
+}
+
+// WriteMetrics writes the logger metrics in the Prometheus text exposition format
+// Args:
+//   - w: Destination of the exposition
+//
+// Returns:
+//   - error: Write errors of w
+func (l *Logger) WriteMetrics(w io.Writer) error {
+	m := l.metrics
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	writeCounterVec(bw, "gojob_logger_records_total", "Log records written to a sink.", m.records)
+	writeCounterVec(bw, "gojob_logger_bytes_total", "Bytes written to a sink.", m.bytes)
+	writeCounterVec(bw, "gojob_logger_write_errors_total", "Log records that failed to be written.", m.writeErrors)
+	writeCounterVec(bw, "gojob_logger_dropped_records_total", "Log records discarded without being written.", m.dropped)
+	writeCounter(bw, "gojob_logger_rotations_total", "Log file rotations.", m.rotations)
+	writeCounter(bw, "gojob_logger_deleted_files_total", "Old log files deleted by retention.", m.deletedFiles)
+
+	name := "gojob_logger_write_duration_seconds"
+	fmt.Fprintf(bw, "# HELP %s Time spent writing a record to a sink.\n# TYPE %s histogram\n", name, name)
+	for _, key := range sortedKeys(m.durations) {
+		h := m.durations[key]
+		var cumulative uint64
+		for i, bound := range writeDurationBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(bw, "%s_bucket{level=%q,sink=%q,le=\"%g\"} %d\n", name, key.level, key.sink, bound, cumulative)
+		}
+		fmt.Fprintf(bw, "%s_bucket{level=%q,sink=%q,le=\"+Inf\"} %d\n", name, key.level, key.sink, h.count)
+		fmt.Fprintf(bw, "%s_sum{level=%q,sink=%q} %g\n", name, key.level, key.sink, h.sum)
+		fmt.Fprintf(bw, "%s_count{level=%q,sink=%q} %d\n", name, key.level, key.sink, h.count)
+	}
+	return bw.Flush()
+}
+
+// MetricsHandler returns an HTTP handler serving the logger metrics in the
+// Prometheus text exposition format
+func (l *Logger) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := l.WriteMetrics(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// writeCounterVec writes a counter family labelled by level and sink
+func writeCounterVec(w io.Writer, name, help string, values map[metricKey]uint64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	for _, key := range sortedKeys(values) {
+		fmt.Fprintf(w, "%s{level=%q,sink=%q} %d\n", name, key.level, key.sink, values[key])
+	}
+}
+
+// writeCounter writes an unlabelled counter
+func writeCounter(w io.Writer, name, help string, value uint64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, value)
+}
+
+// sortedKeys returns the keys of a series map in a stable order
+func sortedKeys[V any](values map[metricKey]V) []metricKey {
+	keys := make([]metricKey, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].sink != keys[j].sink {
+			return keys[i].sink < keys[j].sink
+		}
+		return keys[i].level < keys[j].level
+	})
+	return keys
+}
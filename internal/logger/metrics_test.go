@@ -0,0 +1,90 @@
+package logger
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLoggerMetrics tests record, byte, drop and cleanup counters
+func TestLoggerMetrics(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// An expired file is deleted on startup
+	oldFile := filepath.Join(tempDir, "metrics_2020-01-01.log")
+	os.WriteFile(oldFile, []byte("old"), 0644)
+	oldTime := time.Now().AddDate(0, 0, -10)
+	os.Chtimes(oldFile, oldTime, oldTime)
+
+	logger, err := New(LoggerConfig{
+		Level:         InfoLevel,
+		OutputType:    "file",
+		LogDir:        tempDir,
+		FilePrefix:    "metrics",
+		RetentionDays: 1,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	logger.Debug("filtered")
+	logger.Info("first")
+	logger.Info("second")
+	logger.Error("failure")
+	logger.rotateAndCleanup()
+	logger.Close()
+	logger.Warn("after close")
+
+	var sb strings.Builder
+	if err := logger.WriteMetrics(&sb); err != nil {
+		t.Fatalf("WriteMetrics() error = %v", err)
+	}
+	out := sb.String()
+
+	// The deletion itself is logged as an info record
+	for _, want := range []string{
+		`gojob_logger_records_total{level="info",sink="file"} 3`,
+		`gojob_logger_records_total{level="error",sink="file"} 1`,
+		`gojob_logger_dropped_records_total{level="warn",sink="file"} 1`,
+		`gojob_logger_rotations_total 1`,
+		`gojob_logger_deleted_files_total 1`,
+		`gojob_logger_write_duration_seconds_count{level="info",sink="file"} 3`,
+		`gojob_logger_write_duration_seconds_bucket{level="error",sink="file",le="+Inf"} 1`,
+		"# TYPE gojob_logger_write_duration_seconds histogram",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Metrics missing %q\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, `level="debug"`) {
+		t.Error("Filtered records should not be counted")
+	}
+
+	content, _ := os.ReadFile(filepath.Join(tempDir, "metrics_"+todayStr()+".log"))
+	if !strings.Contains(out, "gojob_logger_bytes_total{level=\"info\",sink=\"file\"} ") || len(content) == 0 {
+		t.Error("Byte counter should be exposed")
+	}
+}
+
+// TestMetricsHandler tests the Prometheus HTTP handler
+func TestMetricsHandler(t *testing.T) {
+	logger, err := New(LoggerConfig{OutputType: "file", LogDir: t.TempDir(), FilePrefix: "handler"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer logger.Close()
+	logger.Warn("warning")
+
+	rec := httptest.NewRecorder()
+	logger.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, `gojob_logger_records_total{level="warn",sink="file"} 1`) {
+		t.Errorf("Unexpected body:\n%s", body)
+	}
+}
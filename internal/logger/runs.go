@@ -0,0 +1,224 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RunLogConfig contains configuration options for per-run log files
+type RunLogConfig struct {
+	LogDir   string   // Base directory; files are written to <LogDir>/<job>/<run-id>.log
+	Level    LogLevel // Minimum level for log calls made through a run logger
+	KeepRuns int      // Number of run files kept per job (default: 10)
+}
+
+// RunLogManager creates loggers scoped to a single job run and applies
+// per-job retention to their files
+type RunLogManager struct {
+	mu       sync.Mutex
+	logDir   string
+	level    LogLevel
+	keepRuns int
+	active   map[string]bool // Paths of runs that are still open
+}
+
+// RunLogger is a file logger for one job run. Besides the usual level
+// methods it implements io.Writer so command output can be appended to the
+// same file.
+type RunLogger struct {
+	*Logger
+	Job     string // Job name
+	RunID   string // Run identifier
+	Path    string // Full path of the run log file
+	manager *RunLogManager
+	once    sync.Once
+}
+
+// NewRunLogManager creates a run log manager rooted at config.LogDir
+func NewRunLogManager(config RunLogConfig) (*RunLogManager, error) {
+	if config.LogDir == "" {
+		return nil, errors.New("log directory is required for run logs")
+	}
+	if config.Level < DebugLevel || config.Level > ErrorLevel {
+		return nil, fmt.Errorf("invalid log level: %d", int(config.Level))
+	}
+
+	// Set default number of kept runs if not specified
+	if config.KeepRuns <= 0 {
+		config.KeepRuns = 10
+	}
+
+	if err := os.MkdirAll(config.LogDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %v", err)
+	}
+
+	return &RunLogManager{
+		logDir:   config.LogDir,
+		level:    config.Level,
+		keepRuns: config.KeepRuns,
+		active:   make(map[string]bool),
+	}, nil
+}
+
+// StartRun opens <LogDir>/<job>/<runID>.log and returns a logger writing to
+// it. An empty runID is replaced by a timestamp. The caller must Close the
+// returned logger when the run finishes.
+func (m *RunLogManager) StartRun(job, runID string) (*RunLogger, error) {
+	if runID == "" {
+		runID = time.Now().Format("20060102_150405.000000000")
+	}
+	if err := validateRunName("job", job); err != nil {
+		return nil, err
+	}
+	if err := validateRunName("run id", runID); err != nil {
+		return nil, err
+	}
+
+	jobDir := filepath.Join(m.logDir, job)
+	if err := os.MkdirAll(jobDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create job log directory: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &Logger{
+		level:      m.level,
+		outputType: "file",
+		logDir:     jobDir,
+		filePrefix: runID,
+		fileName:   runID + ".log",
+		metrics:    newLoggerMetrics(),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+	if err := l.setupFileLogger(); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	run := &RunLogger{
+		Logger:  l,
+		Job:     job,
+		RunID:   runID,
+		Path:    filepath.Join(jobDir, l.fileName),
+		manager: m,
+	}
+
+	m.mu.Lock()
+	m.active[run.Path] = true
+	m.mu.Unlock()
+
+	m.pruneRuns(jobDir)
+	return run, nil
+}
+
+// Run opens a run logger, passes it to fn and closes it when fn returns
+func (m *RunLogManager) Run(job, runID string, fn func(run *RunLogger) error) error {
+	run, err := m.StartRun(job, runID)
+	if err != nil {
+		return err
+	}
+	defer run.Close()
+	return fn(run)
+}
+
+// Write appends raw bytes (typically command output) to the run log file
+func (r *RunLogger) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := metricKey{level: "output", sink: r.outputType}
+	if r.currentFile == nil {
+		r.metrics.addDropped(key)
+		return 0, os.ErrClosed
+	}
+
+	start := time.Now()
+	n, err := r.currentFile.Write(p)
+	r.metrics.addWrite(key, n, time.Since(start), err)
+	return n, err
+}
+
+// Close closes the run log file and applies the job's retention
+func (r *RunLogger) Close() {
+	r.once.Do(func() {
+		r.Logger.Close()
+
+		r.manager.mu.Lock()
+		delete(r.manager.active, r.Path)
+		r.manager.mu.Unlock()
+
+		r.manager.pruneRuns(filepath.Dir(r.Path))
+	})
+}
+
+// pruneRuns deletes the oldest finished run files of a job so that at most
+// keepRuns files remain
+func (m *RunLogManager) pruneRuns(jobDir string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries, err := os.ReadDir(jobDir)
+	if err != nil {
+		log.Printf("Warning: failed to read job log directory %s: %v", jobDir, err)
+		return
+	}
+
+	type runFile struct {
+		path    string
+		modTime time.Time
+	}
+	var runs []runFile
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".log") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			log.Printf("Warning: failed to get file info for %s: %v", entry.Name(), err)
+			continue
+		}
+		runs = append(runs, runFile{path: filepath.Join(jobDir, entry.Name()), modTime: info.ModTime()})
+	}
+	if len(runs) <= m.keepRuns {
+		return
+	}
+
+	// Oldest first
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].modTime.Before(runs[j].modTime)
+	})
+
+	excess := len(runs) - m.keepRuns
+	for _, run := range runs {
+		if excess == 0 {
+			break
+		}
+		if m.active[run.path] {
+			continue // Never delete a run that is still being written
+		}
+		if err := os.Remove(run.path); err != nil {
+			log.Printf("Warning: failed to delete old run log %s: %v", run.path, err)
+			continue
+		}
+		excess--
+	}
+}
+
+// validateRunName rejects names that would escape the log directory
+func validateRunName(kind, name string) error {
+	if name == "" {
+		return fmt.Errorf("%s is required for run logs", kind)
+	}
+	if name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid %s %q: must not contain path separators", kind, name)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRunLogger tests that log calls and raw output share the run file
+func TestRunLogger(t *testing.T) {
+	tempDir := t.TempDir()
+
+	manager, err := NewRunLogManager(RunLogConfig{LogDir: tempDir, Level: InfoLevel})
+	if err != nil {
+		t.Fatalf("NewRunLogManager() error = %v", err)
+	}
+
+	var path string
+	err = manager.Run("backup", "run-1", func(run *RunLogger) error {
+		path = run.Path
+		run.Debug("Debug message should not be output")
+		run.Info("Starting backup")
+		fmt.Fprintf(run, "command output line\n")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if want := filepath.Join(tempDir, "backup", "run-1.log"); path != want {
+		t.Errorf("Path = %q, want %q", path, want)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read run log: %v", err)
+	}
+	contentStr := string(content)
+	if !strings.Contains(contentStr, "[INFO] Starting backup") {
+		t.Error("Run log should contain log calls")
+	}
+	if !strings.Contains(contentStr, "command output line") {
+		t.Error("Run log should contain command output")
+	}
+	if strings.Contains(contentStr, "Debug message") {
+		t.Error("Debug message should not be output at Info level")
+	}
+}
+
+// TestRunLoggerClosed tests that writes fail once the run is finished
+func TestRunLoggerClosed(t *testing.T) {
+	manager, err := NewRunLogManager(RunLogConfig{LogDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewRunLogManager() error = %v", err)
+	}
+
+	run, err := manager.StartRun("job", "")
+	if err != nil {
+		t.Fatalf("StartRun() error = %v", err)
+	}
+	if run.RunID == "" {
+		t.Error("Empty run id should be generated")
+	}
+	run.Close()
+	run.Close() // Closing twice must be safe
+
+	if _, err := run.Write([]byte("late output")); err == nil {
+		t.Error("Write after Close should return error")
+	}
+}
+
+// TestRunLogRetention tests that only the last runs of each job are kept
+func TestRunLogRetention(t *testing.T) {
+	tempDir := t.TempDir()
+
+	manager, err := NewRunLogManager(RunLogConfig{LogDir: tempDir, KeepRuns: 2})
+	if err != nil {
+		t.Fatalf("NewRunLogManager() error = %v", err)
+	}
+
+	// An active run must survive pruning even if it is the oldest
+	active, err := manager.StartRun("job", "active")
+	if err != nil {
+		t.Fatalf("StartRun() error = %v", err)
+	}
+	defer active.Close()
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(active.Path, old, old)
+
+	for i := 1; i <= 4; i++ {
+		run, err := manager.StartRun("job", fmt.Sprintf("run-%d", i))
+		if err != nil {
+			t.Fatalf("StartRun() error = %v", err)
+		}
+		run.Close()
+		modTime := time.Now().Add(time.Duration(i-5) * time.Minute)
+		os.Chtimes(run.Path, modTime, modTime)
+	}
+
+	// Another job is pruned independently
+	if err := manager.Run("other", "run-1", func(*RunLogger) error { return nil }); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(tempDir, "job"))
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	want := "active.log run-4.log"
+	if got := strings.Join(names, " "); got != want {
+		t.Errorf("Kept runs = %q, want %q", got, want)
+	}
+
+	if _, err := os.Stat(filepath.Join(tempDir, "other", "run-1.log")); err != nil {
+		t.Errorf("Run of other job should be kept: %v", err)
+	}
+}
+
+// TestRunLogManagerErrors tests invalid configurations and names
+func TestRunLogManagerErrors(t *testing.T) {
+	if _, err := NewRunLogManager(RunLogConfig{}); err == nil {
+		t.Error("Missing log directory should return error")
+	}
+
+	manager, err := NewRunLogManager(RunLogConfig{LogDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewRunLogManager() error = %v", err)
+	}
+	for _, job := range []string{"", "..", "a/b"} {
+		if _, err := manager.StartRun(job, "run"); err == nil {
+			t.Errorf("StartRun(%q) should return error", job)
+		}
+	}
+	if _, err := manager.StartRun("job", "../escape"); err == nil {
+		t.Error("Run id with path separator should return error")
+	}
+}
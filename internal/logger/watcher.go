@@ -0,0 +1,112 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// defaultWatchInterval is how often a watched config file is checked for changes
+const defaultWatchInterval = 2 * time.Second
+
+// ConfigWatcher reloads a logger configuration file when it changes
+type ConfigWatcher struct {
+	path     string
+	interval time.Duration
+	logger   *Logger
+	modTime  time.Time // Modification time of the last applied version
+	size     int64     // Size of the last applied version
+	cancel   context.CancelFunc
+	done     chan struct{}
+	once     sync.Once
+}
+
+// WatchConfig loads the configuration file at path, applies it to the logger
+// and keeps polling the file, applying every change to the running logger
+// until the watcher or the logger is closed. Reload failures are logged and
+// the previous configuration stays in effect.
+// Args:
+//   - path:     YAML or TOML configuration file
+//   - interval: Polling interval (default: 2s)
+//
+// Returns:
+//   - *ConfigWatcher: Handle used to stop watching
+//   - error:          Errors loading or applying the initial configuration
+func (l *Logger) WatchConfig(path string, interval time.Duration) (*ConfigWatcher, error) {
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+
+	w := &ConfigWatcher{
+		path:     path,
+		interval: interval,
+		logger:   l,
+		done:     make(chan struct{}),
+	}
+	if err := w.reload(); err != nil {
+		return nil, err
+	}
+
+	// Stop together with the logger
+	ctx, cancel := context.WithCancel(l.ctx)
+	w.cancel = cancel
+	go w.run(ctx)
+	return w, nil
+}
+
+// run polls the configuration file until ctx is cancelled
+func (w *ConfigWatcher) run(ctx context.Context) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			info, err := os.Stat(w.path)
+			if err != nil {
+				w.logger.Error("Failed to stat logger config %s: %v", w.path, err)
+				continue
+			}
+			if info.ModTime().Equal(w.modTime) && info.Size() == w.size {
+				continue
+			}
+			if err := w.reload(); err != nil {
+				w.logger.Error("Failed to reload logger config %s: %v", w.path, err)
+				continue
+			}
+			w.logger.Info("Reloaded logger config from %s", w.path)
+		case <-ctx.Done():
+			return // Exit when watcher or logger is closed
+		}
+	}
+}
+
+// reload reads the configuration file and applies it to the logger
+func (w *ConfigWatcher) reload() error {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return fmt.Errorf("failed to read logger config: %w", err)
+	}
+
+	// Remember the version even if it is invalid so it is not retried every tick
+	w.modTime = info.ModTime()
+	w.size = info.Size()
+
+	config, err := LoadConfig(w.path)
+	if err != nil {
+		return err
+	}
+	return w.logger.Reconfigure(config)
+}
+
+// Close stops watching the configuration file
+func (w *ConfigWatcher) Close() {
+	w.once.Do(func() {
+		w.cancel()
+		<-w.done
+	})
+}
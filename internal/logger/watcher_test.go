@@ -0,0 +1,134 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// todayStr returns the date used in today's log file names
+func todayStr() string {
+	return time.Now().Format("2006-01-02")
+}
+
+// TestWatchConfig tests that file changes are applied to the running logger
+func TestWatchConfig(t *testing.T) {
+	ResetGlobalLogger()
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "logger.yaml")
+
+	writeConfig := func(content string, modTime time.Time) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Failed to set modification time: %v", err)
+		}
+	}
+	writeConfig("level: info\n", time.Now().Add(-time.Minute))
+
+	logger, err := InitGlobalLogger(LoggerConfig{})
+	if err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+	defer ResetGlobalLogger()
+
+	watcher, err := logger.WatchConfig(path, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("WatchConfig() error = %v", err)
+	}
+	defer watcher.Close()
+
+	if got := logger.Config().Level; got != InfoLevel {
+		t.Fatalf("Initial level = %v, want info", got)
+	}
+
+	// An invalid version is reported and ignored
+	writeConfig("level: loud\n", time.Now().Add(-30*time.Second))
+	time.Sleep(50 * time.Millisecond)
+	if got := logger.Config().Level; got != InfoLevel {
+		t.Errorf("Invalid config changed level to %v", got)
+	}
+
+	writeConfig("level: error\nretention_days: 2\n", time.Now())
+	deadline := time.Now().Add(2 * time.Second)
+	for logger.Config().Level != ErrorLevel {
+		if time.Now().After(deadline) {
+			t.Fatal("Config change was not applied")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := logger.Config().RetentionDays; got != 2 {
+		t.Errorf("RetentionDays = %d, want 2", got)
+	}
+
+	if _, err := logger.WatchConfig(filepath.Join(tempDir, "missing.yaml"), 0); err == nil {
+		t.Error("Watching a missing file should return error")
+	}
+}
+
+// TestWatchConfigWhileLogging tests reloads concurrent with logging; run
+// with -race to detect unsynchronised access to the configuration
+func TestWatchConfigWhileLogging(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "logger.yaml")
+	writeConfig := func(level, prefix string, retention int, modTime time.Time) {
+		content := fmt.Sprintf("level: %s\noutput_type: file\nlog_dir: %s\nfile_prefix: %s\nretention_days: %d\n", level, tempDir, prefix, retention)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Failed to set modification time: %v", err)
+		}
+	}
+	start := time.Now().Add(-time.Hour)
+	writeConfig("debug", "a", 7, start)
+
+	logger, err := New(LoggerConfig{OutputType: "console"})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+	watcher, err := logger.WatchConfig(path, time.Millisecond)
+	if err != nil {
+		t.Fatalf("WatchConfig() error = %v", err)
+	}
+	defer watcher.Close()
+
+	stop := make(chan struct{})
+	var logging sync.WaitGroup
+	for range 4 {
+		logging.Add(1)
+		go func() {
+			defer logging.Done()
+			ctx := logger.BufferContext(context.Background())
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				logger.Debug("debug")
+				logger.Info("info")
+				logger.Log(WarnLevel, "warn", F("k", 1))
+				logger.DebugContext(ctx, "buffered")
+				logger.InfoContext(ctx, "info")
+			}
+		}()
+	}
+
+	for i := range 50 {
+		if i%2 == 0 {
+			writeConfig("error", "b", 3, start.Add(time.Duration(i+1)*time.Second))
+		} else {
+			writeConfig("debug", "a", 7, start.Add(time.Duration(i+1)*time.Second))
+		}
+		time.Sleep(3 * time.Millisecond)
+	}
+	close(stop)
+	logging.Wait()
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/Robinmxc/go-job/internal/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// GinLogger returns a gin middleware that logs every request through l (the
+// global logger when nil) and recovers panics into Error records with a 500
+// response. Records carry method, path, status, latency, client and request
+// ID fields; 4xx responses are logged as Warn and 5xx as Error.
+func GinLogger(l *logger.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		requestID := c.GetHeader(RequestIDHeader)
+		if requestID == "" {
+			requestID = newRequestID()
+		}
+		c.Set(RequestIDKey, requestID)
+		c.Request = c.Request.WithContext(withRequestID(c.Request.Context(), requestID))
+		c.Header(RequestIDHeader, requestID)
+
+		path := c.Request.URL.Path
+		if c.Request.URL.RawQuery != "" {
+			path += "?" + c.Request.URL.RawQuery
+		}
+
+		defer func() {
+			lg := resolveLogger(l)
+			fields := []logger.Field{
+				logger.F("method", c.Request.Method),
+				logger.F("path", path),
+				logger.F("status", c.Writer.Status()),
+				logger.F("latency", time.Since(start)),
+				logger.F("client", c.ClientIP()),
+				logger.F("request_id", requestID),
+			}
+
+			if rec := recover(); rec != nil {
+				c.AbortWithStatus(http.StatusInternalServerError)
+				fields[2] = logger.F("status", http.StatusInternalServerError)
+				if lg != nil {
+					fields = append(fields, logger.F("panic", fmt.Sprint(rec)), logger.F("stack", string(debug.Stack())))
+					lg.Log(logger.ErrorLevel, "panic recovered", fields...)
+				}
+				return
+			}
+			if lg == nil {
+				return
+			}
+
+			if len(c.Errors) > 0 {
+				fields = append(fields, logger.F("errors", c.Errors.String()))
+			}
+
+			level := logger.InfoLevel
+			switch status := c.Writer.Status(); {
+			case status >= http.StatusInternalServerError:
+				level = logger.ErrorLevel
+			case status >= http.StatusBadRequest:
+				level = logger.WarnLevel
+			}
+			lg.Log(level, "request", fields...)
+		}()
+
+		c.Next()
+	}
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Robinmxc/go-job/internal/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// newTestLogger creates a file logger and returns a function reading its content
+func newTestLogger(t *testing.T) (*logger.Logger, func() string) {
+	t.Helper()
+	dir := t.TempDir()
+	l, err := logger.New(logger.LoggerConfig{OutputType: "file", LogDir: dir, FilePrefix: "mw"})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	t.Cleanup(l.Close)
+
+	return l, func() string {
+		content, err := os.ReadFile(filepath.Join(dir, "mw_"+time.Now().Format("2006-01-02")+".log"))
+		if err != nil {
+			t.Fatalf("Failed to read log file: %v", err)
+		}
+		return string(content)
+	}
+}
+
+// TestGinLogger tests request records, request IDs and panic recovery
+func TestGinLogger(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l, readLog := newTestLogger(t)
+
+	router := gin.New()
+	router.Use(GinLogger(l))
+	router.GET("/jobs/:id", func(c *gin.Context) {
+		if c.GetString(RequestIDKey) != RequestIDFromContext(c.Request.Context()) {
+			t.Error("Request ID should be available from gin and request context")
+		}
+		c.String(http.StatusOK, "ok")
+	})
+	router.GET("/missing", func(c *gin.Context) {
+		c.Status(http.StatusNotFound)
+	})
+	router.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+
+	tests := []struct {
+		path       string
+		requestID  string
+		wantStatus int
+		wantLog    []string
+	}{
+		{"/jobs/7?verbose=1", "req-1", http.StatusOK, []string{"[INFO] request method=GET", `path="/jobs/7?verbose=1"`, "status=200", "request_id=req-1"}},
+		{"/missing", "req-2", http.StatusNotFound, []string{"[WARN] request", "status=404", "request_id=req-2"}},
+		{"/panic", "req-3", http.StatusInternalServerError, []string{"[ERROR] panic recovered", "status=500", "panic=boom", "request_id=req-3"}},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.Header.Set(RequestIDHeader, tt.requestID)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.path, rec.Code, tt.wantStatus)
+		}
+		if got := rec.Header().Get(RequestIDHeader); got != tt.requestID {
+			t.Errorf("%s: response request ID = %q, want %q", tt.path, got, tt.requestID)
+		}
+		content := readLog()
+		for _, want := range tt.wantLog {
+			if !strings.Contains(content, want) {
+				t.Errorf("%s: log missing %q\n%s", tt.path, want, content)
+			}
+		}
+	}
+
+	// A request ID is generated when the client does not send one
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jobs/1", nil))
+	if id := rec.Header().Get(RequestIDHeader); len(id) != 32 {
+		t.Errorf("Generated request ID = %q, want 32 hex characters", id)
+	}
+}
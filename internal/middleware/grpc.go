@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/Robinmxc/go-job/internal/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor returns a gRPC interceptor that logs every unary
+// call through l (the global logger when nil) and turns panics into
+// codes.Internal errors logged at Error level
+func UnaryServerInterceptor(l *logger.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		start := time.Now()
+		ctx, requestID := grpcRequestID(ctx)
+		grpc.SetHeader(ctx, metadata.Pairs(strings.ToLower(RequestIDHeader), requestID))
+
+		defer func() {
+			if rec := recover(); rec != nil {
+				err = status.Errorf(codes.Internal, "panic: %v", rec)
+				logGRPC(ctx, l, info.FullMethod, requestID, start, err, rec)
+				return
+			}
+			logGRPC(ctx, l, info.FullMethod, requestID, start, err, nil)
+		}()
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns the streaming counterpart of
+// UnaryServerInterceptor; the record is written when the stream ends
+func StreamServerInterceptor(l *logger.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		start := time.Now()
+		ctx, requestID := grpcRequestID(ss.Context())
+		ss.SetHeader(metadata.Pairs(strings.ToLower(RequestIDHeader), requestID))
+
+		defer func() {
+			if rec := recover(); rec != nil {
+				err = status.Errorf(codes.Internal, "panic: %v", rec)
+				logGRPC(ctx, l, info.FullMethod, requestID, start, err, rec)
+				return
+			}
+			logGRPC(ctx, l, info.FullMethod, requestID, start, err, nil)
+		}()
+
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// contextStream overrides the context of a server stream
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the context carrying the request ID
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// grpcRequestID reads the request ID from incoming metadata or generates one
+func grpcRequestID(ctx context.Context) (context.Context, string) {
+	var requestID string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(RequestIDHeader); len(values) > 0 {
+			requestID = values[0]
+		}
+	}
+	if requestID == "" {
+		requestID = newRequestID()
+	}
+	return withRequestID(ctx, requestID), requestID
+}
+
+// logGRPC writes the record of a finished call
+func logGRPC(ctx context.Context, l *logger.Logger, method, requestID string, start time.Time, err error, panicValue interface{}) {
+	lg := resolveLogger(l)
+	if lg == nil {
+		return
+	}
+
+	code := status.Code(err)
+	client := "unknown"
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		client = p.Addr.String()
+	}
+
+	fields := []logger.Field{
+		logger.F("method", method),
+		logger.F("status", code),
+		logger.F("latency", time.Since(start)),
+		logger.F("client", client),
+		logger.F("request_id", requestID),
+	}
+
+	if panicValue != nil {
+		fields = append(fields, logger.F("panic", fmt.Sprint(panicValue)), logger.F("stack", string(debug.Stack())))
+		lg.Log(logger.ErrorLevel, "panic recovered", fields...)
+		return
+	}
+	if err != nil {
+		fields = append(fields, logger.F("error", status.Convert(err).Message()))
+	}
+	lg.Log(grpcLevel(code), "rpc", fields...)
+}
+
+// grpcLevel maps a status code to the level of its record
+func grpcLevel(code codes.Code) logger.LogLevel {
+	switch code {
+	case codes.OK:
+		return logger.InfoLevel
+	case codes.Canceled, codes.InvalidArgument, codes.NotFound, codes.AlreadyExists,
+		codes.PermissionDenied, codes.Unauthenticated, codes.FailedPrecondition, codes.OutOfRange:
+		return logger.WarnLevel
+	default:
+		return logger.ErrorLevel
+	}
+}
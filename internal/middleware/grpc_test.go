@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// fakeServerStream is a minimal grpc.ServerStream for interceptor tests
+type fakeServerStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	header metadata.MD
+}
+
+func (s *fakeServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeServerStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+// incomingContext builds a server side context with peer and request ID
+func incomingContext(requestID string) context.Context {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000},
+	})
+	return metadata.NewIncomingContext(ctx, metadata.Pairs("x-request-id", requestID))
+}
+
+// TestUnaryServerInterceptor tests unary records and panic recovery
+func TestUnaryServerInterceptor(t *testing.T) {
+	l, readLog := newTestLogger(t)
+	interceptor := UnaryServerInterceptor(l)
+
+	tests := []struct {
+		name     string
+		handler  grpc.UnaryHandler
+		wantCode codes.Code
+		wantLog  []string
+	}{
+		{
+			name: "ok",
+			handler: func(ctx context.Context, req interface{}) (interface{}, error) {
+				if RequestIDFromContext(ctx) != "rpc-ok" {
+					t.Error("Request ID should be stored in the handler context")
+				}
+				return "resp", nil
+			},
+			wantCode: codes.OK,
+			wantLog:  []string{"[INFO] rpc method=/jobs.Jobs/Get status=OK", "client=10.0.0.1:5000", "request_id=rpc-ok"},
+		},
+		{
+			name: "not-found",
+			handler: func(ctx context.Context, req interface{}) (interface{}, error) {
+				return nil, status.Error(codes.NotFound, "no such job")
+			},
+			wantCode: codes.NotFound,
+			wantLog:  []string{"[WARN] rpc", "status=NotFound", `error="no such job"`},
+		},
+		{
+			name: "panic",
+			handler: func(ctx context.Context, req interface{}) (interface{}, error) {
+				panic("boom")
+			},
+			wantCode: codes.Internal,
+			wantLog:  []string{"[ERROR] panic recovered", "status=Internal", "panic=boom", "request_id=rpc-panic"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := &grpc.UnaryServerInfo{FullMethod: "/jobs.Jobs/Get"}
+			_, err := interceptor(incomingContext("rpc-"+tt.name), "req", info, tt.handler)
+			if code := status.Code(err); code != tt.wantCode {
+				t.Errorf("Code = %v, want %v", code, tt.wantCode)
+			}
+
+			content := readLog()
+			for _, want := range tt.wantLog {
+				if !strings.Contains(content, want) {
+					t.Errorf("Log missing %q\n%s", want, content)
+				}
+			}
+		})
+	}
+}
+
+// TestStreamServerInterceptor tests stream records and response headers
+func TestStreamServerInterceptor(t *testing.T) {
+	l, readLog := newTestLogger(t)
+	interceptor := StreamServerInterceptor(l)
+
+	stream := &fakeServerStream{ctx: incomingContext("stream-1")}
+	info := &grpc.StreamServerInfo{FullMethod: "/jobs.Jobs/Watch", IsServerStream: true}
+	err := interceptor(nil, stream, info, func(srv interface{}, ss grpc.ServerStream) error {
+		if RequestIDFromContext(ss.Context()) != "stream-1" {
+			t.Error("Request ID should be stored in the stream context")
+		}
+		return status.Error(codes.Unavailable, "backend down")
+	})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if got := stream.header.Get("x-request-id"); len(got) != 1 || got[0] != "stream-1" {
+		t.Errorf("Response header request ID = %v", got)
+	}
+	content := readLog()
+	if !strings.Contains(content, "[ERROR] rpc method=/jobs.Jobs/Watch status=Unavailable") {
+		t.Errorf("Unexpected log content:\n%s", content)
+	}
+}
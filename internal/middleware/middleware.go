@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/Robinmxc/go-job/internal/logger"
+)
+
+// RequestIDHeader is the HTTP header (and lower-cased gRPC metadata key)
+// carrying the request ID
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDKey is the gin context key holding the request ID
+const RequestIDKey = "request_id"
+
+// requestIDKey is the context key holding the request ID
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the request ID stored by the middleware, if any
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// withRequestID stores the request ID in ctx
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// newRequestID generates a random 128 bit request ID
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// resolveLogger returns l, falling back to the global logger when l is nil
+func resolveLogger(l *logger.Logger) *logger.Logger {
+	if l != nil {
+		return l
+	}
+	return logger.GetLogger()
+}
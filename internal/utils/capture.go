@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// cappedBuffer keeps command output within a byte limit: the first headCap
+// bytes and the most recent limit-headCap bytes are retained, everything in
+// between is dropped. A limit of 0 keeps everything.
+type cappedBuffer struct {
+	limit   int
+	headCap int
+	head    []byte
+	tail    []byte // Grows to at most twice its capacity before it is trimmed
+	total   int64  // Bytes written, including dropped ones
+}
+
+// newCappedBuffer creates a buffer for the output limits of config
+func newCappedBuffer(config CommandConfig) *cappedBuffer {
+	b := &cappedBuffer{limit: config.MaxOutputBytes}
+	if b.limit <= 0 {
+		return b
+	}
+
+	// Set defaults if not specified
+	b.headCap = config.OutputHeadBytes
+	if b.headCap <= 0 {
+		b.headCap = b.limit / 2
+	}
+	b.headCap = min(b.headCap, b.limit)
+	return b
+}
+
+// Write appends p, dropping what exceeds the limit
+func (b *cappedBuffer) Write(p []byte) {
+	b.total += int64(len(p))
+	if b.limit <= 0 {
+		b.head = append(b.head, p...)
+		return
+	}
+
+	n := min(b.headCap-len(b.head), len(p))
+	b.head = append(b.head, p[:n]...)
+	p = p[n:]
+
+	tailCap := b.limit - b.headCap
+	if tailCap == 0 || len(p) == 0 {
+		return
+	}
+	b.tail = append(b.tail, p...)
+	if len(b.tail) > 2*tailCap {
+		b.tail = append(b.tail[:0], b.tail[len(b.tail)-tailCap:]...)
+	}
+}
+
+// Bytes returns a copy of the retained output
+func (b *cappedBuffer) Bytes() []byte {
+	tail := b.tail
+	if b.limit > 0 {
+		tail = tail[max(0, len(tail)-(b.limit-b.headCap)):]
+	}
+	out := make([]byte, 0, len(b.head)+len(tail))
+	return append(append(out, b.head...), tail...)
+}
+
+// Len returns the number of retained bytes
+func (b *cappedBuffer) Len() int {
+	if b.limit <= 0 {
+		return len(b.head)
+	}
+	return len(b.head) + min(len(b.tail), b.limit-b.headCap)
+}
+
+// Truncated reports whether output was dropped
+func (b *cappedBuffer) Truncated() bool {
+	return int64(b.Len()) < b.total
+}
+
+// spillFile receives the complete combined output of a command
+type spillFile struct {
+	path string
+	file *os.File
+	err  error // First write error (if any)
+}
+
+// newSpillFile creates a new private file in dir named after command
+func newSpillFile(dir string, command string) (*spillFile, error) {
+	path := filepath.Join(dir, GenerateFileName(filepath.Base(command)+"_", ".out"))
+	if err := WriteFile(path, nil, WriteConfig{
+		Perm: 0600,
+		Flag: os.O_WRONLY | os.O_CREATE | os.O_EXCL,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to create output file: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open output file: %w", err)
+	}
+	return &spillFile{path: path, file: file}, nil
+}
+
+// Write appends p to the file; after the first error further output is discarded
+func (s *spillFile) Write(p []byte) {
+	if s.err != nil {
+		return
+	}
+	if _, err := s.file.Write(p); err != nil {
+		s.err = fmt.Errorf("failed to write output file %s: %w", s.path, err)
+	}
+}
+
+// Close closes the file and returns the first error writing it
+func (s *spillFile) Close() error {
+	if err := s.file.Close(); err != nil && s.err == nil {
+		s.err = fmt.Errorf("failed to close output file %s: %w", s.path, err)
+	}
+	return s.err
+}
@@ -0,0 +1,157 @@
+package utils
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCappedBuffer tests head and tail retention
+func TestCappedBuffer(t *testing.T) {
+	tests := []struct {
+		name          string
+		limit         int
+		head          int
+		writes        []string
+		want          string
+		wantTruncated bool
+	}{
+		{
+			name:   "Unlimited",
+			writes: []string{"abc", "def"},
+			want:   "abcdef",
+		},
+		{
+			name:   "Within limit",
+			limit:  10,
+			writes: []string{"abc", "def"},
+			want:   "abcdef",
+		},
+		{
+			name:          "Head and tail",
+			limit:         6,
+			writes:        []string{"abcd", "efgh", "ijkl"},
+			want:          "abcjkl",
+			wantTruncated: true,
+		},
+		{
+			name:          "Custom head",
+			limit:         4,
+			head:          1,
+			writes:        []string{"0123456789"},
+			want:          "0789",
+			wantTruncated: true,
+		},
+		{
+			name:          "Head only",
+			limit:         3,
+			head:          3,
+			writes:        []string{"ab", "cd", "ef"},
+			want:          "abc",
+			wantTruncated: true,
+		},
+		{
+			name:          "Many small writes",
+			limit:         4,
+			writes:        strings.Split(strings.Repeat("x", 50)+"yz", ""),
+			want:          "xxyz",
+			wantTruncated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newCappedBuffer(CommandConfig{MaxOutputBytes: tt.limit, OutputHeadBytes: tt.head})
+			var total int
+			for _, w := range tt.writes {
+				b.Write([]byte(w))
+				total += len(w)
+			}
+			if got := string(b.Bytes()); got != tt.want {
+				t.Errorf("Bytes() = %q, want %q", got, tt.want)
+			}
+			if b.Len() != len(tt.want) {
+				t.Errorf("Len() = %d, want %d", b.Len(), len(tt.want))
+			}
+			if b.Truncated() != tt.wantTruncated {
+				t.Errorf("Truncated() = %v, want %v", b.Truncated(), tt.wantTruncated)
+			}
+			if b.total != int64(total) {
+				t.Errorf("total = %d, want %d", b.total, total)
+			}
+		})
+	}
+}
+
+// TestExecuteCommandOutputLimit tests capped output with the complete
+// output spilled to a file
+func TestExecuteCommandOutputLimit(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+	dir := t.TempDir()
+
+	result, err := ExecuteCommand(CommandConfig{
+		Command:        "sh",
+		Args:           []string{"-c", "echo begin; yes line | head -n 100000; echo end"},
+		MaxOutputBytes: 1024,
+		SpillDir:       dir,
+	})
+	if err != nil || !result.Successful {
+		t.Fatalf("ExecuteCommand() error = %v", err)
+	}
+
+	if !result.Truncated {
+		t.Error("Truncated = false, want true")
+	}
+	if len(result.Output) != 1024 || len(result.Stdout) != 1024 {
+		t.Errorf("len(Output) = %d, len(Stdout) = %d, want 1024", len(result.Output), len(result.Stdout))
+	}
+	if !bytes.HasPrefix(result.Output, []byte("begin\n")) || !bytes.HasSuffix(result.Output, []byte("line\nend\n")) {
+		t.Errorf("Output does not keep head and tail: %q ... %q", result.Output[:16], result.Output[len(result.Output)-16:])
+	}
+	wantBytes := int64(len("begin\n") + 100000*len("line\n") + len("end\n"))
+	if result.OutputBytes != wantBytes {
+		t.Errorf("OutputBytes = %d, want %d", result.OutputBytes, wantBytes)
+	}
+	var chunkBytes int
+	for _, c := range result.Chunks {
+		chunkBytes += len(c.Data)
+	}
+	if chunkBytes > 1024 {
+		t.Errorf("Chunks hold %d bytes, want at most 1024", chunkBytes)
+	}
+
+	if filepath.Dir(result.OutputFile) != dir {
+		t.Fatalf("OutputFile = %q, want a file in %s", result.OutputFile, dir)
+	}
+	data, err := os.ReadFile(result.OutputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	if int64(len(data)) != wantBytes || !bytes.HasSuffix(data, []byte("end\n")) {
+		t.Errorf("Output file holds %d bytes, want %d", len(data), wantBytes)
+	}
+	if info, _ := os.Stat(result.OutputFile); info.Mode().Perm() != 0600 {
+		t.Errorf("Output file mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+// TestExecuteCommandSpillDirError tests that an unusable spill directory
+// fails before the command starts
+func TestExecuteCommandSpillDirError(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+	blocker := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := ExecuteCommand(CommandConfig{
+		Command:  "echo",
+		Args:     []string{"hello"},
+		SpillDir: filepath.Join(blocker, "sub"),
+	})
+	if err == nil || !strings.Contains(err.Error(), "output file") {
+		t.Errorf("ExecuteCommand() error = %v, want output file error", err)
+	}
+}
@@ -0,0 +1,21 @@
+package utils
+
+import "errors"
+
+// ErrCgroupUnavailable is returned when a command cannot be placed in a
+// cgroup, e.g. because cgroup v2 is not mounted or the parent is not writable
+var ErrCgroupUnavailable = errors.New("cgroup v2 unavailable")
+
+// defaultCgroupParent is the cgroup under which transient cgroups are created
+const defaultCgroupParent = "/sys/fs/cgroup/gojob"
+
+// CgroupConfig places a command in a transient cgroup v2 that is removed
+// once the command has finished. Processes left in the cgroup are killed
+// with it, so nothing started by the command outlives it.
+type CgroupConfig struct {
+	Parent    string  // Writable cgroup v2 directory for the transient cgroup (default: /sys/fs/cgroup/gojob)
+	MemoryMax int64   // memory.max in bytes, 0 for unlimited
+	CPUMax    float64 // cpu.max in CPUs, e.g. 0.5 for half a CPU, 0 for unlimited
+	PidsMax   int64   // pids.max, 0 for unlimited
+	IOWeight  int     // io.weight between 1 and 10000, 0 to keep the default
+}
@@ -0,0 +1,218 @@
+//go:build linux
+
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// transientCgroup is the cgroup of a single command run
+type transientCgroup struct {
+	path string
+	dir  *os.File // Passed to clone to start the command inside the cgroup
+}
+
+// newTransientCgroup creates a cgroup with the limits of config
+func newTransientCgroup(config *CgroupConfig) (*transientCgroup, error) {
+	parent := config.Parent
+	if parent == "" {
+		parent = defaultCgroupParent
+	}
+	if err := checkCgroup2(parent); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return nil, fmt.Errorf("%w: cgroup parent %s is not writable: %v", ErrCgroupUnavailable, parent, err)
+	}
+
+	// Enable the controllers needed for the limits in the parent
+	var controllers []string
+	if config.MemoryMax > 0 {
+		controllers = append(controllers, "memory")
+	}
+	if config.CPUMax > 0 {
+		controllers = append(controllers, "cpu")
+	}
+	if config.PidsMax > 0 {
+		controllers = append(controllers, "pids")
+	}
+	if config.IOWeight > 0 {
+		controllers = append(controllers, "io")
+	}
+	if err := enableControllers(parent, controllers); err != nil {
+		return nil, err
+	}
+
+	path, err := os.MkdirTemp(parent, "run-")
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to create cgroup in %s: %v", ErrCgroupUnavailable, parent, err)
+	}
+	c := &transientCgroup{path: path}
+
+	if err := c.setLimits(config); err != nil {
+		c.remove()
+		return nil, err
+	}
+	if c.dir, err = os.Open(path); err != nil {
+		c.remove()
+		return nil, fmt.Errorf("failed to open cgroup %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// checkCgroup2 verifies that path, or its closest existing ancestor, is on a
+// cgroup v2 file system
+func checkCgroup2(path string) error {
+	for dir := path; ; dir = filepath.Dir(dir) {
+		var st unix.Statfs_t
+		err := unix.Statfs(dir, &st)
+		if errors.Is(err, unix.ENOENT) && dir != "/" {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrCgroupUnavailable, err)
+		}
+		if st.Type != unix.CGROUP2_SUPER_MAGIC {
+			return fmt.Errorf("%w: %s is not on a cgroup v2 file system", ErrCgroupUnavailable, path)
+		}
+		return nil
+	}
+}
+
+// enableControllers makes controllers available to the children of parent
+func enableControllers(parent string, controllers []string) error {
+	if len(controllers) == 0 {
+		return nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(parent, "cgroup.controllers"))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCgroupUnavailable, err)
+	}
+	available := strings.Fields(string(data))
+	for _, controller := range controllers {
+		if !slices.Contains(available, controller) {
+			return fmt.Errorf("%w: controller %s is not available in %s", ErrCgroupUnavailable, controller, parent)
+		}
+		if err := writeCgroupFile(parent, "cgroup.subtree_control", "+"+controller); err != nil {
+			return fmt.Errorf("%w: %v", ErrCgroupUnavailable, err)
+		}
+	}
+	return nil
+}
+
+// setLimits writes the interface files for the limits of config
+func (c *transientCgroup) setLimits(config *CgroupConfig) error {
+	if config.MemoryMax > 0 {
+		if err := writeCgroupFile(c.path, "memory.max", strconv.FormatInt(config.MemoryMax, 10)); err != nil {
+			return err
+		}
+		// Kill the whole cgroup on OOM instead of a single process
+		writeCgroupFile(c.path, "memory.oom.group", "1")
+	}
+	if config.CPUMax > 0 {
+		const period = 100000 // Microseconds
+		quota := max(int64(config.CPUMax*period), 1000)
+		if err := writeCgroupFile(c.path, "cpu.max", fmt.Sprintf("%d %d", quota, period)); err != nil {
+			return err
+		}
+	}
+	if config.PidsMax > 0 {
+		if err := writeCgroupFile(c.path, "pids.max", strconv.FormatInt(config.PidsMax, 10)); err != nil {
+			return err
+		}
+	}
+	if config.IOWeight > 0 {
+		if err := writeCgroupFile(c.path, "io.weight", "default "+strconv.Itoa(config.IOWeight)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeCgroupFile writes value to an interface file of the cgroup at path
+func writeCgroupFile(path string, file string, value string) error {
+	if err := os.WriteFile(filepath.Join(path, file), []byte(value), 0); err != nil {
+		return fmt.Errorf("failed to set %s to %q: %w", file, value, err)
+	}
+	return nil
+}
+
+// attach makes cmd start inside the cgroup
+func (c *transientCgroup) attach(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(c.dir.Fd())
+}
+
+// started releases the directory handle once the command was started
+func (c *transientCgroup) started() {
+	c.dir.Close()
+}
+
+// kill kills every process in the cgroup, using cgroup.kill where the
+// kernel supports it and signalling each listed process otherwise
+func (c *transientCgroup) kill() {
+	if writeCgroupFile(c.path, "cgroup.kill", "1") == nil {
+		return
+	}
+	for range 10 {
+		data, err := os.ReadFile(filepath.Join(c.path, "cgroup.procs"))
+		if err != nil || len(bytes.TrimSpace(data)) == 0 {
+			return
+		}
+		for _, field := range strings.Fields(string(data)) {
+			if pid, err := strconv.Atoi(field); err == nil {
+				syscall.Kill(pid, syscall.SIGKILL)
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// oomKilled reports whether the kernel killed a process of the cgroup
+// because memory.max was reached
+func (c *transientCgroup) oomKilled() bool {
+	data, err := os.ReadFile(filepath.Join(c.path, "memory.events"))
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if count, ok := strings.CutPrefix(line, "oom_kill "); ok {
+			return count != "0"
+		}
+	}
+	return false
+}
+
+// remove kills the remaining processes and deletes the cgroup
+func (c *transientCgroup) remove() error {
+	c.kill()
+
+	// The cgroup can only be removed once its processes have exited
+	var err error
+	for range 100 {
+		if err = unix.Rmdir(c.path); !errors.Is(err, unix.EBUSY) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to remove cgroup %s: %w", c.path, err)
+	}
+	return nil
+}
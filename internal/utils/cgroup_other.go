@@ -0,0 +1,23 @@
+//go:build !linux
+
+package utils
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// transientCgroup is not supported outside Linux
+type transientCgroup struct{}
+
+// newTransientCgroup always fails outside Linux
+func newTransientCgroup(config *CgroupConfig) (*transientCgroup, error) {
+	return nil, fmt.Errorf("%w: not supported on %s", ErrCgroupUnavailable, runtime.GOOS)
+}
+
+func (c *transientCgroup) attach(cmd *exec.Cmd) {}
+func (c *transientCgroup) started()             {}
+func (c *transientCgroup) kill()                {}
+func (c *transientCgroup) oomKilled() bool      { return false }
+func (c *transientCgroup) remove() error        { return nil }
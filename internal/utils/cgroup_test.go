@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// cgroupTestParent returns a fresh cgroup parent for a test, skipping the
+// test when cgroup v2 is not writable here
+func cgroupTestParent(t *testing.T) string {
+	root := "/sys/fs/cgroup"
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err != nil {
+		root = "/sys/fs/cgroup/unified" // Hybrid hierarchy
+	}
+	parent := filepath.Join(root, fmt.Sprintf("gojob-test-%d", time.Now().UnixNano()))
+
+	c, err := newTransientCgroup(&CgroupConfig{Parent: parent})
+	if err != nil {
+		os.Remove(parent)
+		t.Skipf("cgroup v2 is not writable: %v", err)
+	}
+	c.started()
+	c.remove()
+	t.Cleanup(func() { os.Remove(parent) })
+	return parent
+}
+
+// cgroupEntries lists the child cgroups of parent
+func cgroupEntries(t *testing.T, parent string) []string {
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", parent, err)
+	}
+	var children []string
+	for _, e := range entries {
+		if e.IsDir() {
+			children = append(children, e.Name())
+		}
+	}
+	return children
+}
+
+// TestExecuteCommandCgroup tests that the command runs in a transient
+// cgroup that is removed afterwards together with stray processes
+func TestExecuteCommandCgroup(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+	parent := cgroupTestParent(t)
+
+	result, err := ExecuteCommand(CommandConfig{
+		Command: "sh",
+		Args:    []string{"-c", "cat /proc/self/cgroup; setsid sleep 100 > /dev/null 2>&1 & echo $!"},
+		Cgroup:  &CgroupConfig{Parent: parent},
+	})
+	if err != nil {
+		t.Fatalf("ExecuteCommand() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(result.Output)), "\n")
+	if !strings.Contains(string(result.Output), "0::/"+filepath.Base(parent)+"/run-") {
+		t.Errorf("Command did not run in a transient cgroup: %q", result.Output)
+	}
+	pid, err := strconv.Atoi(lines[len(lines)-1])
+	if err != nil {
+		t.Fatalf("Unexpected output %q", result.Output)
+	}
+	if !processGone(pid) {
+		syscall.Kill(pid, syscall.SIGKILL)
+		t.Errorf("Stray process %d survived the command", pid)
+	}
+	if children := cgroupEntries(t, parent); len(children) != 0 {
+		t.Errorf("Transient cgroups were not removed: %v", children)
+	}
+}
+
+// TestExecuteCommandCgroupTimeout tests that a timeout kills processes that
+// left the process group
+func TestExecuteCommandCgroupTimeout(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+	parent := cgroupTestParent(t)
+	pidFile := filepath.Join(t.TempDir(), "pid")
+
+	result, err := ExecuteCommand(CommandConfig{
+		Command:     "sh",
+		Args:        []string{"-c", "setsid sh -c 'trap \"\" TERM; sleep 100' > /dev/null 2>&1 & echo $! > " + pidFile + "; sleep 100"},
+		Timeout:     200 * time.Millisecond,
+		GracePeriod: 100 * time.Millisecond,
+		Cgroup:      &CgroupConfig{Parent: parent},
+	})
+	if err == nil || !result.TimedOut {
+		t.Fatalf("ExecuteCommand() error = %v, want timeout", err)
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatalf("Failed to read pid file: %v", err)
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	if !processGone(pid) {
+		syscall.Kill(pid, syscall.SIGKILL)
+		t.Errorf("Process %d outside the process group survived the timeout", pid)
+	}
+	if children := cgroupEntries(t, parent); len(children) != 0 {
+		t.Errorf("Transient cgroups were not removed: %v", children)
+	}
+}
+
+// TestExecuteCommandCgroupOOM tests OOM kill detection
+func TestExecuteCommandCgroupOOM(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+	parent := cgroupTestParent(t)
+
+	result, err := ExecuteCommand(CommandConfig{
+		Command: "sh",
+		Args:    []string{"-c", "head -c 200000000 /dev/zero | tail > /dev/null"},
+		Timeout: 30 * time.Second,
+		Cgroup:  &CgroupConfig{Parent: parent, MemoryMax: 16 << 20},
+	})
+	if errors.Is(err, ErrCgroupUnavailable) {
+		t.Skipf("Memory controller unavailable: %v", err)
+	}
+	if err == nil || result.Successful {
+		t.Fatal("ExecuteCommand() should fail")
+	}
+	if !result.OOMKilled {
+		t.Errorf("OOMKilled = false, want true (signal %q)", result.Signal)
+	}
+}
+
+// TestExecuteCommandCgroupUnavailable tests the error when the parent is
+// not a writable cgroup v2 directory
+func TestExecuteCommandCgroupUnavailable(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	_, err := ExecuteCommand(CommandConfig{
+		Command: "true",
+		Cgroup:  &CgroupConfig{Parent: filepath.Join(t.TempDir(), "cgroup")},
+	})
+	if !errors.Is(err, ErrCgroupUnavailable) {
+		t.Errorf("ExecuteCommand() error = %v, want ErrCgroupUnavailable", err)
+	}
+}
@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+var defaultGroups groupLooker = &defaultGroupLooker{}
+
+// groupLooker resolves groups from the group database
+type groupLooker interface {
+	LookupGroup(name string) (*user.Group, error)
+	LookupGroupId(gid string) (*user.Group, error)
+	GroupIds(username string, gid string) ([]string, error)
+}
+
+type defaultGroupLooker struct{}
+
+func (d *defaultGroupLooker) LookupGroup(name string) (*user.Group, error) {
+	return user.LookupGroup(name)
+}
+
+func (d *defaultGroupLooker) LookupGroupId(gid string) (*user.Group, error) {
+	return user.LookupGroupId(gid)
+}
+
+// GroupIds returns the groups the user is a member of, including gid
+func (d *defaultGroupLooker) GroupIds(username string, gid string) ([]string, error) {
+	return (&user.User{Username: username, Gid: gid}).GroupIds()
+}
+
+// lookupGroup retrieves a group from the system by name or numeric ID
+func lookupGroup(name string, looker groupLooker) (*user.Group, error) {
+	// Handle empty name case
+	if name == "" {
+		return nil, fmt.Errorf("group name cannot be empty")
+	}
+
+	// Try standard lookup first
+	g, err := looker.LookupGroup(name)
+	if err == nil {
+		return g, nil
+	}
+
+	// Fallback: Try by ID if name looks like a numeric ID
+	if isNumeric(name) {
+		if g, err = looker.LookupGroupId(name); err == nil {
+			return g, nil
+		}
+	}
+	return nil, fmt.Errorf("group lookup failed: %w", err)
+}
+
+// resolveCredential builds the credential of a command from User and
+// Group. account is the looked up User, or nil to keep the current user.
+// The user's supplementary groups are set as a login would set them; with
+// only Group set the current supplementary groups are kept.
+// Returns nil when neither User nor Group is set.
+func resolveCredential(config CommandConfig, account *userInfo) (*syscall.Credential, error) {
+	if account == nil && config.Group == "" {
+		return nil, nil
+	}
+
+	cred := &syscall.Credential{
+		Uid: uint32(os.Getuid()),
+		Gid: uint32(os.Getgid()),
+	}
+	if account != nil {
+		uid, err := strconv.Atoi(account.Uid)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user ID for user %s: %w", config.User, err)
+		}
+
+		gid, err := strconv.Atoi(account.Gid)
+		if err != nil {
+			return nil, fmt.Errorf("invalid group ID for user %s: %w", config.User, err)
+		}
+		cred.Uid, cred.Gid = uint32(uid), uint32(gid)
+
+		groups, err := defaultGroups.GroupIds(account.Name, account.Gid)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lookup groups of user %s: %w", config.User, err)
+		}
+		for _, g := range groups {
+			id, err := strconv.Atoi(g)
+			if err != nil {
+				return nil, fmt.Errorf("invalid supplementary group ID %s for user %s: %w", g, config.User, err)
+			}
+			cred.Groups = append(cred.Groups, uint32(id))
+		}
+	} else {
+		cred.NoSetGroups = true
+	}
+
+	if config.Group != "" {
+		group, err := lookupGroup(config.Group, defaultGroups)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lookup group %s: %w", config.Group, err)
+		}
+
+		gid, err := strconv.Atoi(group.Gid)
+		if err != nil {
+			return nil, fmt.Errorf("invalid group ID for group %s: %w", config.Group, err)
+		}
+		cred.Gid = uint32(gid)
+	}
+	return cred, nil
+}
+
+// startProcess starts cmd, applying the umask and scheduling attributes of
+// config to the new process only
+func startProcess(cmd *exec.Cmd, config CommandConfig) error {
+	if hasScheduling(config) {
+		return startWithScheduling(cmd, config)
+	}
+	if config.Umask == nil {
+		return cmd.Start()
+	}
+	return startWithUmask(cmd, int(*config.Umask&os.ModePerm))
+}
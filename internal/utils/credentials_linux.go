@@ -0,0 +1,46 @@
+//go:build linux
+
+package utils
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// startOnThread starts cmd from a dedicated OS thread prepared by setup.
+// The child inherits the attributes of the thread it was forked from. The
+// thread is never unlocked, so it exits with its goroutine and the modified
+// attributes never leak to other goroutines.
+func startOnThread(cmd *exec.Cmd, setup func() error) error {
+	errc := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		if err := setup(); err != nil {
+			errc <- err
+			return
+		}
+		errc <- cmd.Start()
+	}()
+	return <-errc
+}
+
+// startWithUmask starts cmd with the given umask. The umask is shared by
+// all threads of a process, so the starting thread first gets a private
+// copy of the file system attributes.
+func startWithUmask(cmd *exec.Cmd, mask int) error {
+	return startOnThread(cmd, func() error {
+		return setThreadUmask(mask)
+	})
+}
+
+// setThreadUmask sets the umask of the calling thread only
+func setThreadUmask(mask int) error {
+	if err := unix.Unshare(unix.CLONE_FS); err != nil {
+		return fmt.Errorf("failed to unshare file system attributes: %w", err)
+	}
+	unix.Umask(mask)
+	return nil
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+
+package utils
+
+import (
+	"os/exec"
+	"sync"
+	"syscall"
+)
+
+// umaskMu serialises umask changes of the process
+var umaskMu sync.Mutex
+
+// startWithUmask starts cmd with the given umask. Without per-thread file
+// system attributes the process umask is changed while the command starts,
+// which briefly affects files created concurrently by other goroutines.
+func startWithUmask(cmd *exec.Cmd, mask int) error {
+	umaskMu.Lock()
+	defer umaskMu.Unlock()
+
+	old := syscall.Umask(mask)
+	defer syscall.Umask(old)
+	return cmd.Start()
+}
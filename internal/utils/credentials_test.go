@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// MockGroupLooker is a mock implementation of group lookup for testing
+type MockGroupLooker struct {
+	Groups  map[string]*user.Group
+	Members map[string][]string // Supplementary group IDs per username
+	Error   error
+}
+
+func (m *MockGroupLooker) LookupGroup(name string) (*user.Group, error) {
+	if m.Error != nil {
+		return nil, m.Error
+	}
+	if g, ok := m.Groups[name]; ok {
+		return g, nil
+	}
+	return nil, fmt.Errorf("group %s not found", name)
+}
+
+func (m *MockGroupLooker) LookupGroupId(gid string) (*user.Group, error) {
+	if m.Error != nil {
+		return nil, m.Error
+	}
+	for _, g := range m.Groups {
+		if g.Gid == gid {
+			return g, nil
+		}
+	}
+	return nil, fmt.Errorf("group with ID %s not found", gid)
+}
+
+func (m *MockGroupLooker) GroupIds(username string, gid string) ([]string, error) {
+	if m.Error != nil {
+		return nil, m.Error
+	}
+	return append([]string{gid}, m.Members[username]...), nil
+}
+
+// TestResolveCredential tests uid, gid and supplementary group resolution
+func TestResolveCredential(t *testing.T) {
+	defaultGroups = &MockGroupLooker{
+		Groups: map[string]*user.Group{
+			"staff":  {Gid: "50", Name: "staff"},
+			"broken": {Gid: "x", Name: "broken"},
+		},
+		Members: map[string][]string{"alice": {"50", "60"}},
+	}
+	t.Cleanup(func() { defaultGroups = &defaultGroupLooker{} })
+	alice := &userInfo{Uid: "1001", Gid: "1001", Name: "alice"}
+
+	tests := []struct {
+		name       string
+		config     CommandConfig
+		account    *userInfo
+		wantCred   *syscall.Credential
+		wantErrMsg string
+	}{
+		{
+			name:     "No user or group",
+			config:   CommandConfig{},
+			wantCred: nil,
+		},
+		{
+			name:     "User with supplementary groups",
+			config:   CommandConfig{User: "alice"},
+			account:  alice,
+			wantCred: &syscall.Credential{Uid: 1001, Gid: 1001, Groups: []uint32{1001, 50, 60}},
+		},
+		{
+			name:     "User with group override",
+			config:   CommandConfig{User: "alice", Group: "staff"},
+			account:  alice,
+			wantCred: &syscall.Credential{Uid: 1001, Gid: 50, Groups: []uint32{1001, 50, 60}},
+		},
+		{
+			name:     "Numeric group",
+			config:   CommandConfig{User: "alice", Group: "50"},
+			account:  alice,
+			wantCred: &syscall.Credential{Uid: 1001, Gid: 50, Groups: []uint32{1001, 50, 60}},
+		},
+		{
+			name:   "Group only",
+			config: CommandConfig{Group: "staff"},
+			wantCred: &syscall.Credential{
+				Uid:         uint32(os.Getuid()),
+				Gid:         50,
+				NoSetGroups: true,
+			},
+		},
+		{
+			name:       "Unknown group",
+			config:     CommandConfig{Group: "nogroup"},
+			wantErrMsg: "failed to lookup group nogroup",
+		},
+		{
+			name:       "Invalid group ID",
+			config:     CommandConfig{Group: "broken"},
+			wantErrMsg: "invalid group ID for group broken",
+		},
+		{
+			name:       "Invalid user ID",
+			config:     CommandConfig{User: "bad"},
+			account:    &userInfo{Uid: "x", Gid: "1"},
+			wantErrMsg: "invalid user ID for user bad",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cred, err := resolveCredential(tt.config, tt.account)
+			if tt.wantErrMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrMsg) {
+					t.Errorf("resolveCredential() error = %v, want %q", err, tt.wantErrMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveCredential() error = %v", err)
+			}
+			if (cred == nil) != (tt.wantCred == nil) {
+				t.Fatalf("resolveCredential() = %+v, want %+v", cred, tt.wantCred)
+			}
+			if cred != nil && (cred.Uid != tt.wantCred.Uid || cred.Gid != tt.wantCred.Gid ||
+				!slices.Equal(cred.Groups, tt.wantCred.Groups) || cred.NoSetGroups != tt.wantCred.NoSetGroups) {
+				t.Errorf("resolveCredential() = %+v, want %+v", cred, tt.wantCred)
+			}
+		})
+	}
+}
+
+// TestExecuteCommandCredentials tests groups, login environment and umask
+// of a command running as another user
+func TestExecuteCommandCredentials(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("Switching users requires root")
+	}
+	defaultLooker = &MockUserLooker{
+		Users: map[string]*user.User{"nobody": {Uid: "65534", Gid: "65534", Username: "nobody", HomeDir: "/nonexistent"}},
+	}
+	defaultGroups = &MockGroupLooker{
+		Groups:  map[string]*user.Group{"staff": {Gid: "50", Name: "staff"}},
+		Members: map[string][]string{"nobody": {"4242"}},
+	}
+	t.Cleanup(func() { defaultGroups = &defaultGroupLooker{} })
+
+	mask := os.FileMode(0027)
+	oldMask := syscall.Umask(0022)
+	defer syscall.Umask(oldMask)
+
+	result, err := ExecuteCommand(CommandConfig{
+		Command: "sh",
+		Args:    []string{"-c", "id -u; id -g; id -G; echo $HOME $USER $LOGNAME; umask"},
+		User:    "nobody",
+		Group:   "staff",
+		Umask:   &mask,
+	})
+	if err != nil {
+		t.Fatalf("ExecuteCommand() error = %v, output: %s", err, result.Output)
+	}
+
+	want := "65534\n50\n50 4242 65534\n/nonexistent nobody nobody\n0027\n"
+	if got := string(result.Output); got != want {
+		t.Errorf("Output = %q, want %q", got, want)
+	}
+	if current := syscall.Umask(0022); current != 0022 {
+		t.Errorf("Umask of the calling process changed to %o", current)
+	}
+}
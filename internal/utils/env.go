@@ -0,0 +1,222 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// EnvPolicy selects which variables of the calling process a command inherits
+type EnvPolicy string
+
+// Environment policies
+const (
+	EnvInherit   EnvPolicy = "inherit"   // Inherit the complete environment (default)
+	EnvClean     EnvPolicy = "clean"     // Inherit nothing
+	EnvAllowlist EnvPolicy = "allowlist" // Inherit only the variables matching EnvAllow
+)
+
+// buildEnv returns the environment of a command: the inherited variables
+// selected by the policy, the login variables of account (if any), the
+// variables of EnvFiles and finally config.Env, later entries taking
+// precedence. ${VAR} references in EnvFiles and Env are expanded against
+// the variables before them. Returns nil to inherit the environment
+// unchanged.
+func buildEnv(config CommandConfig, account *userInfo) ([]string, error) {
+	policy := config.EnvPolicy
+	if policy == "" {
+		policy = EnvInherit
+	}
+	if policy == EnvInherit && account == nil && len(config.EnvFiles) == 0 && len(config.Env) == 0 {
+		return nil, nil
+	}
+
+	var env []string
+	switch policy {
+	case EnvInherit:
+		env = os.Environ()
+	case EnvClean:
+		env = []string{}
+	case EnvAllowlist:
+		env = filterEnv(os.Environ(), config.EnvAllow)
+	default:
+		return nil, fmt.Errorf("unknown environment policy %q", policy)
+	}
+
+	if account != nil {
+		if account.Home != "" {
+			env = append(env, "HOME="+account.Home)
+		}
+		if account.Name != "" {
+			env = append(env, "USER="+account.Name, "LOGNAME="+account.Name)
+		}
+	}
+
+	for _, file := range config.EnvFiles {
+		vars, err := loadDotenv(file, env)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, vars...)
+	}
+	for _, kv := range config.Env {
+		env = append(env, expandVars(kv, envLookup(env)))
+	}
+	return env, nil
+}
+
+// filterEnv keeps the variables whose name matches one of patterns; patterns
+// are names or path.Match patterns such as "LC_*"
+func filterEnv(env []string, patterns []string) []string {
+	filtered := []string{}
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, name); ok {
+				filtered = append(filtered, kv)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// envLookup returns a lookup function for env, where later entries take
+// precedence. A nil env looks up the environment of the calling process.
+func envLookup(env []string) func(string) (string, bool) {
+	if env == nil {
+		return os.LookupEnv
+	}
+	return func(name string) (string, bool) {
+		for i := len(env) - 1; i >= 0; i-- {
+			if value, ok := strings.CutPrefix(env[i], name+"="); ok {
+				return value, true
+			}
+		}
+		return "", false
+	}
+}
+
+// expandVars replaces ${VAR} and ${VAR:-default} in s. Unset variables
+// expand to the empty string; the default is used when the variable is
+// unset or empty. $${ is an escaped literal ${, and a bare $VAR is left
+// untouched so shell scripts passed as arguments keep working.
+func expandVars(s string, lookup func(string) (string, bool)) string {
+	if !strings.Contains(s, "${") {
+		return s
+	}
+
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i-1] + "${")
+			s = s[i+2:]
+			continue
+		}
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+
+		b.WriteString(s[:i])
+		name, def, hasDefault := strings.Cut(s[i+2:i+end], ":-")
+		value, _ := lookup(name)
+		if value == "" && hasDefault {
+			value = def
+		}
+		b.WriteString(value)
+		s = s[i+end+1:]
+	}
+}
+
+// loadDotenv reads the variables of a dotenv file as KEY=VALUE entries.
+// Lines may start with "export"; blank lines and lines starting with # are
+// skipped. Values may be double quoted (with \n, \t, \" and \\ escapes),
+// single quoted (taken literally) or unquoted (with trailing " #" comments
+// removed). References in unquoted and double quoted values are expanded
+// against env and the variables read before them.
+func loadDotenv(file string, env []string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open env file: %w", err)
+	}
+	defer f.Close()
+
+	var vars []string
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		text = strings.TrimPrefix(text, "export ")
+
+		name, raw, ok := strings.Cut(text, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("%s:%d: invalid line, expected KEY=VALUE", file, line)
+		}
+
+		value, expand, err := parseDotenvValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", file, line, err)
+		}
+		if expand {
+			value = expandVars(value, envLookup(append(env[:len(env):len(env)], vars...)))
+		}
+		vars = append(vars, name+"="+value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read env file %s: %w", file, err)
+	}
+	return vars, nil
+}
+
+// parseDotenvValue unquotes a dotenv value and reports whether references
+// in it are expanded
+func parseDotenvValue(raw string) (string, bool, error) {
+	switch {
+	case strings.HasPrefix(raw, "'"):
+		end := strings.IndexByte(raw[1:], '\'')
+		if end < 0 {
+			return "", false, fmt.Errorf("unterminated single quoted value")
+		}
+		return raw[1 : end+1], false, nil
+
+	case strings.HasPrefix(raw, `"`):
+		var b strings.Builder
+		for i := 1; i < len(raw); i++ {
+			switch c := raw[i]; {
+			case c == '"':
+				return b.String(), true, nil
+			case c == '\\' && i+1 < len(raw):
+				i++
+				switch raw[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				default:
+					b.WriteByte(raw[i])
+				}
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return "", false, fmt.Errorf("unterminated double quoted value")
+
+	default:
+		if i := strings.Index(raw, " #"); i >= 0 {
+			raw = strings.TrimSpace(raw[:i])
+		}
+		return raw, true, nil
+	}
+}
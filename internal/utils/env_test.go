@@ -0,0 +1,246 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestExpandVars tests ${VAR} expansion with defaults and escapes
+func TestExpandVars(t *testing.T) {
+	lookup := envLookup([]string{"NAME=first", "EMPTY=", "NAME=job", "DIR=/srv"})
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"plain", "plain"},
+		{"${NAME}", "job"},
+		{"${DIR}/${NAME}.log", "/srv/job.log"},
+		{"${MISSING}", ""},
+		{"${MISSING:-fallback}", "fallback"},
+		{"${EMPTY:-fallback}", "fallback"},
+		{"${NAME:-fallback}", "job"},
+		{"$${NAME}", "${NAME}"},
+		{"$NAME and $1", "$NAME and $1"},
+		{"${UNTERMINATED", "${UNTERMINATED"},
+	}
+
+	for _, tt := range tests {
+		if got := expandVars(tt.in, lookup); got != tt.want {
+			t.Errorf("expandVars(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestBuildEnv tests policies, login variables and their precedence
+func TestBuildEnv(t *testing.T) {
+	t.Setenv("GOJOB_TEST_SECRET", "hunter2")
+	t.Setenv("GOJOB_TEST_LANG", "C")
+
+	dotenv := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(dotenv, []byte("FROM_FILE=${USER}-file\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	alice := &userInfo{Home: "/home/alice", Name: "alice"}
+
+	tests := []struct {
+		name    string
+		config  CommandConfig
+		account *userInfo
+		want    []string // Expected entries, in order
+		absent  []string // Names that must not be set
+		wantNil bool
+	}{
+		{
+			name:    "Inherit unchanged",
+			config:  CommandConfig{},
+			wantNil: true,
+		},
+		{
+			name:    "Inherit with login variables",
+			config:  CommandConfig{Env: []string{"HOME=/override"}},
+			account: alice,
+			want:    []string{"GOJOB_TEST_SECRET=hunter2", "HOME=/home/alice", "USER=alice", "LOGNAME=alice", "HOME=/override"},
+		},
+		{
+			name:   "Clean",
+			config: CommandConfig{EnvPolicy: EnvClean},
+			want:   []string{},
+			absent: []string{"GOJOB_TEST_SECRET", "PATH"},
+		},
+		{
+			name:   "Allowlist",
+			config: CommandConfig{EnvPolicy: EnvAllowlist, EnvAllow: []string{"GOJOB_TEST_L*"}, Env: []string{"X=${GOJOB_TEST_LANG}"}},
+			want:   []string{"GOJOB_TEST_LANG=C", "X=C"},
+			absent: []string{"GOJOB_TEST_SECRET"},
+		},
+		{
+			name:    "Dotenv before Env",
+			config:  CommandConfig{EnvPolicy: EnvClean, EnvFiles: []string{dotenv}, Env: []string{"BOTH=${FROM_FILE}"}},
+			account: alice,
+			want:    []string{"USER=alice", "FROM_FILE=alice-file", "BOTH=alice-file"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, err := buildEnv(tt.config, tt.account)
+			if err != nil {
+				t.Fatalf("buildEnv() error = %v", err)
+			}
+			if tt.wantNil {
+				if env != nil {
+					t.Errorf("buildEnv() = %v, want nil to inherit", env)
+				}
+				return
+			}
+			if env == nil {
+				t.Fatal("buildEnv() = nil, want an explicit environment")
+			}
+
+			// want must appear in env as an ordered subsequence
+			rest := env
+			for _, w := range tt.want {
+				i := slices.Index(rest, w)
+				if i < 0 {
+					t.Fatalf("buildEnv() = %v, want %q in order", env, w)
+				}
+				rest = rest[i+1:]
+			}
+			for _, name := range tt.absent {
+				if _, ok := envLookup(env)(name); ok {
+					t.Errorf("buildEnv() sets %s, want it absent", name)
+				}
+			}
+		})
+	}
+
+	if _, err := buildEnv(CommandConfig{EnvPolicy: "bogus"}, nil); err == nil {
+		t.Error("buildEnv() with unknown policy should fail")
+	}
+}
+
+// TestLoadDotenv tests dotenv syntax
+func TestLoadDotenv(t *testing.T) {
+	content := `# comment
+PLAIN=value
+export EXPORTED=yes
+SPACED = padded value  # trailing comment
+DOUBLE="line1\nline2 \"quoted\" ${PLAIN}"
+SINGLE='${PLAIN} stays # literal'
+REF=${BASE}/${PLAIN}
+EMPTY=
+
+`
+	file := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	vars, err := loadDotenv(file, []string{"BASE=/opt"})
+	if err != nil {
+		t.Fatalf("loadDotenv() error = %v", err)
+	}
+	want := []string{
+		"PLAIN=value",
+		"EXPORTED=yes",
+		"SPACED=padded value",
+		"DOUBLE=line1\nline2 \"quoted\" value",
+		"SINGLE=${PLAIN} stays # literal",
+		"REF=/opt/value",
+		"EMPTY=",
+	}
+	if !slices.Equal(vars, want) {
+		t.Errorf("loadDotenv() = %q, want %q", vars, want)
+	}
+}
+
+// TestLoadDotenvErrors tests reporting of malformed files
+func TestLoadDotenvErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"Missing separator", "JUSTANAME\n", ".env:1: invalid line"},
+		{"Space in name", "A B=1\n", ".env:1: invalid line"},
+		{"Unterminated double quote", "\nA=\"open\n", ".env:2: unterminated double quoted value"},
+		{"Unterminated single quote", "A='open\n", ".env:1: unterminated single quoted value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), ".env")
+			if err := os.WriteFile(file, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := loadDotenv(file, nil); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("loadDotenv() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := loadDotenv("/nonexistent/.env", nil); err == nil {
+		t.Error("loadDotenv() of a missing file should fail")
+	}
+}
+
+// TestExecuteCommandEnvTemplating tests expansion in Args and WorkingDir
+// and that a clean environment does not leak variables
+func TestExecuteCommandEnvTemplating(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+	t.Setenv("GOJOB_TEST_SECRET", "hunter2")
+	dir := t.TempDir()
+
+	result, err := ExecuteCommand(CommandConfig{
+		Command:    "/bin/sh",
+		Args:       []string{"-c", "pwd; echo ${GREETING}-$GREETING; env | grep -c GOJOB_TEST_SECRET", "${GREETING}"},
+		ExpandArgs: true,
+		WorkingDir: "${WORK}",
+		EnvPolicy:  EnvClean,
+		Env:        []string{"WORK=" + dir, "GREETING=${MISSING:-hello}"},
+	})
+	if err == nil {
+		t.Fatal("ExecuteCommand() should fail because grep finds no match")
+	}
+
+	want := dir + "\nhello-hello\n0\n"
+	if string(result.Output) != want {
+		t.Errorf("Output = %q, want %q", result.Output, want)
+	}
+}
+
+// TestExecuteCommandShellVars tests that Args are passed unchanged unless
+// ExpandArgs is set, so shells expand their own ${VAR} references
+func TestExecuteCommandShellVars(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	tests := []struct {
+		name   string
+		expand bool
+		want   string
+	}{
+		{"Shell variable", false, "5-env\n"},
+		{"Expanded", true, "-env\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ExecuteCommand(CommandConfig{
+				Command:    "sh",
+				Args:       []string{"-c", "x=5; echo ${x}-${FROM_ENV}"},
+				ExpandArgs: tt.expand,
+				Env:        []string{"FROM_ENV=env"},
+			})
+			if err != nil {
+				t.Fatalf("ExecuteCommand() error = %v", err)
+			}
+			if string(result.Output) != tt.want {
+				t.Errorf("Output = %q, want %q", result.Output, tt.want)
+			}
+		})
+	}
+}
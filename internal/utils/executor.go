@@ -2,12 +2,12 @@ package utils
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
-	"strconv"
-	"strings"
 	"syscall"
 	"time"
 )
@@ -18,89 +18,203 @@ var defaultLooker userLooker = &defaultUserLooker{}
 type CommandConfig struct {
 	Command    string        // The command to execute
 	Args       []string      // Command arguments
+	ExpandArgs bool          // Expand ${VAR} references in Args; off so shells see their own ${VAR} (optional)
 	User       string        // User to execute the command as (optional)
-	WorkingDir string        // Working directory for the command (optional)
-	Env        []string      // Environment variables to set (optional)
+	WorkingDir string        // Working directory for the command, may reference ${VAR} (optional)
+	Env        []string      // Environment variables to set, may reference ${VAR} (optional)
+	EnvPolicy  EnvPolicy     // Variables inherited from the calling process (default: EnvInherit)
+	EnvAllow   []string      // Names or patterns of inherited variables for EnvAllowlist
+	EnvFiles   []string      // Dotenv files loaded before Env (optional)
+	Group      string        // Primary group to execute the command as, overriding the user's (optional)
+	Umask      *os.FileMode  // File mode creation mask of the command (optional)
 	Timeout    time.Duration // Command execution timeout (optional)
+
+	IdleTimeout time.Duration // Terminate the command when neither stdout nor stderr produced output for this long (optional)
+
+	Nice        *int            // Nice value from -20 to 19; lowering it below the caller's needs privileges (optional, Linux only)
+	IOClass     IOPriorityClass // I/O scheduling class set with ioprio_set (optional, Linux only)
+	IOLevel     int             // Priority within IOClass from 0 (highest) to 7
+	CPUAffinity []int           // CPUs the command may run on (optional, Linux only)
+
+	Script      string // Inline script run instead of Command, with Args as its arguments (optional)
+	Interpreter string // Interpreter of Script: "sh" (default), "bash" or "python3"
+
+	StdinData []byte    // Data written to standard input (optional)
+	StdinFile string    // File read as standard input (optional)
+	Stdin     io.Reader // Streamed to standard input; not replayable, so excludes retries (optional)
+
+	Stdout       io.Writer         // Receives standard output in real time (optional)
+	Stderr       io.Writer         // Receives standard error in real time (optional)
+	OnOutput     func(OutputChunk) // Called for every chunk of output in real time (optional)
+	LineBuffered bool              // Deliver complete lines instead of raw chunks to OnOutput
+	PTY          *PTYConfig        // Run on a pseudo-terminal instead of pipes (optional, Linux only)
+
+	KillSignal  syscall.Signal // Signal sent to the process group on timeout (default: SIGTERM)
+	GracePeriod time.Duration  // Time between KillSignal and SIGKILL of the process group (default: 5s)
+
+	MaxOutputBytes  int    // Max bytes of output kept in memory per buffer, 0 for unlimited (optional)
+	OutputHeadBytes int    // Bytes of MaxOutputBytes kept from the start, the rest from the end (default: half)
+	SpillDir        string // Directory receiving the complete combined output as a file per attempt (optional)
+
+	Limits ResourceLimits // Resource limits applied to the command's process (optional)
+	Cgroup *CgroupConfig  // Run the command in a transient cgroup v2 (optional, Linux only)
+
+	Sandbox *SandboxConfig // Run the command in new namespaces with a read-only root (optional, Linux only)
+
+	Retry   RetryPolicy  // Re-execution of failed attempts (optional, Timeout applies per attempt)
+	Success SuccessRules // Exit codes and output patterns deciding success (default: exit code 0)
+
+	stdinPipe  *os.File // Output of the previous pipeline stage, replaces the stdin options
+	stdoutPipe *os.File // Input of the next pipeline stage, replaces stdout collection
 }
 
 // CommandResult holds the result of command execution
 type CommandResult struct {
-	Command    string // The executed command
-	TimedOut   bool   // Whether the command timed out
-	Successful bool   // Whether the command executed successfully
-	Output     []byte // Standard output bytes and standard error(combined)
-	ExecError  error  // Execution error (if any)
+	Command    string `json:"command"`    // The executed command
+	TimedOut   bool   `json:"timed_out"`  // Whether the command timed out
+	Canceled   bool   `json:"canceled"`   // Whether the command was terminated by cancellation
+	Successful bool   `json:"successful"` // Whether the command executed successfully
+	Output     []byte `json:"output"`     // Standard output bytes and standard error(combined)
+	ExecError  error  `json:"-"`          // Execution error (if any), serialised as "error"
+
+	Stdout []byte        `json:"stdout"` // Standard output bytes
+	Stderr []byte        `json:"stderr"` // Standard error bytes
+	Chunks []OutputChunk `json:"chunks"` // Output chunks of both streams with timestamps, in arrival order
+
+	Truncated   bool   `json:"truncated"`             // Whether output was dropped because of MaxOutputBytes
+	OutputBytes int64  `json:"output_bytes"`          // Total bytes of output produced, including dropped ones
+	OutputFile  string `json:"output_file,omitempty"` // File holding the complete combined output of the last attempt (SpillDir)
+
+	ExitCode  int            `json:"exit_code"`        // Exit code, -1 if the process did not start or was killed by a signal
+	Signal    string         `json:"signal,omitempty"` // Name of the signal that terminated the process (e.g. "SIGKILL")
+	StartTime time.Time      `json:"start_time"`       // When the process was started
+	EndTime   time.Time      `json:"end_time"`         // When the process was reaped
+	Duration  time.Duration  `json:"duration"`         // Wall clock duration between start and end
+	Usage     *ResourceUsage `json:"usage,omitempty"`  // Resource usage of the process (nil if it did not start)
+
+	LimitExceeded string `json:"limit_exceeded,omitempty"` // Resource limit that terminated the process (e.g. "RLIMIT_CPU")
+	OOMKilled     bool   `json:"oom_killed"`               // Whether a process was killed for exceeding the cgroup's memory.max
+	IdleTimedOut  bool   `json:"idle_timed_out"`           // Whether the command was terminated for producing no output within IdleTimeout
+
+	DecidedBy      string `json:"decided_by,omitempty"`      // Success rule that decided Successful (DecidedBy constants), empty if the command did not run to completion
+	MatchedPattern string `json:"matched_pattern,omitempty"` // Output pattern that decided Successful (if any)
+
+	Attempts []AttemptRecord `json:"attempts"` // Every attempt in order; the other fields describe the last one
+}
+
+// commandResultJSON is the wire form of CommandResult
+type commandResultJSON struct {
+	*commandResultAlias
+	Error string `json:"error,omitempty"`
+}
+
+// commandResultAlias drops the methods of CommandResult to avoid recursion
+type commandResultAlias CommandResult
+
+// MarshalJSON implements json.Marshaler, encoding ExecError as its message
+func (r *CommandResult) MarshalJSON() ([]byte, error) {
+	out := commandResultJSON{commandResultAlias: (*commandResultAlias)(r)}
+	if r.ExecError != nil {
+		out.Error = r.ExecError.Error()
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, restoring ExecError from its message
+func (r *CommandResult) UnmarshalJSON(data []byte) error {
+	in := commandResultJSON{commandResultAlias: (*commandResultAlias)(r)}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	if in.Error != "" {
+		r.ExecError = errors.New(in.Error)
+	}
+	return nil
 }
 
 // ExecuteCommand executes a command with the provided configuration
 func ExecuteCommand(config CommandConfig) (*CommandResult, error) {
-	// Create context with timeout
-	ctx := context.Background()
-	var cancel context.CancelFunc
+	return ExecuteCommandContext(context.Background(), config)
+}
 
-	if config.Timeout > 0 {
-		ctx, cancel = context.WithTimeout(ctx, config.Timeout)
-		defer cancel()
-	}
+// ExecuteCommandContext executes a command and waits for it to finish.
+// Cancelling ctx terminates the command's process group like a timeout does.
+func ExecuteCommandContext(ctx context.Context, config CommandConfig) (*CommandResult, error) {
+	return executeCommand(ctx, config, config.OnOutput)
+}
 
-	// Create the command
-	cmd := exec.CommandContext(ctx, config.Command, config.Args...)
+// ExecuteCommandStream executes a command like ExecuteCommand and sends its
+// output to chunks while it runs, in addition to config.OnOutput. chunks is
+// closed when the command has finished, so the caller typically ranges over
+// it while ExecuteCommandStream runs in another goroutine.
+func ExecuteCommandStream(config CommandConfig, chunks chan<- OutputChunk) (*CommandResult, error) {
+	defer close(chunks)
 
-	// Set working directory if specified
-	if config.WorkingDir != "" {
-		cmd.Dir = config.WorkingDir
+	onOutput := func(chunk OutputChunk) {
+		if config.OnOutput != nil {
+			config.OnOutput(chunk)
+		}
+		chunks <- chunk
 	}
+	return executeCommand(context.Background(), config, onOutput)
+}
 
-	// Set environment variables if specified
-	if len(config.Env) > 0 {
-		cmd.Env = append(os.Environ(), config.Env...)
+// executeCommand runs the command to completion, forwarding output to onOutput
+func executeCommand(ctx context.Context, config CommandConfig, onOutput func(OutputChunk)) (*CommandResult, error) {
+	h, err := startCommand(ctx, config, onOutput)
+	if err != nil {
+		return nil, err
 	}
+	return h.Wait()
+}
 
-	// Configure user if specified
+// prepareCommand creates the command described by config without starting it
+func prepareCommand(ctx context.Context, config CommandConfig) (*exec.Cmd, error) {
+	// Resolve user if specified
+	var account *userInfo
 	if config.User != "" {
-		user, err := lookupUser(config.User, defaultLooker)
+		u, err := lookupUser(config.User, defaultLooker)
 		if err != nil {
 			return nil, fmt.Errorf("failed to lookup user %s: %w", config.User, err)
 		}
+		account = u
+	}
 
-		uid, err := strconv.Atoi(user.Uid)
-		if err != nil {
-			return nil, fmt.Errorf("invalid user ID for user %s: %w", config.User, err)
-		}
-
-		gid, err := strconv.Atoi(user.Gid)
-		if err != nil {
-			return nil, fmt.Errorf("invalid group ID for user %s: %w", config.User, err)
-		}
+	// Build the environment, which ${VAR} references are expanded against
+	env, err := buildEnv(config, account)
+	if err != nil {
+		return nil, err
+	}
+	lookup := envLookup(env)
 
-		cmd.SysProcAttr = &syscall.SysProcAttr{
-			Credential: &syscall.Credential{
-				Uid: uint32(uid),
-				Gid: uint32(gid),
-			},
+	// Create the command
+	args := config.Args
+	if config.ExpandArgs {
+		args = make([]string, len(config.Args))
+		for i, arg := range config.Args {
+			args[i] = expandVars(arg, lookup)
 		}
 	}
+	cmd := exec.CommandContext(ctx, config.Command, args...)
+	cmd.Env = env
 
-	// Execute the command
-	out, err := cmd.CombinedOutput()
-
-	// Process result
-	result := &CommandResult{
-		Command:    config.Command + " " + strings.Join(config.Args, " "),
-		TimedOut:   false,
-		Successful: false,
-		Output:     out,
-		ExecError:  err,
+	// Set working directory if specified
+	if config.WorkingDir != "" {
+		cmd.Dir = expandVars(config.WorkingDir, lookup)
 	}
 
-	// Check for timeout
-	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
-		result.TimedOut = true
-		result.ExecError = fmt.Errorf("command timed out after %v", config.Timeout)
-		return result, result.ExecError
+	// Configure user and groups if specified
+	cred, err := resolveCredential(config, account)
+	if err != nil {
+		return nil, err
+	}
+	if cred != nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: cred}
 	}
 
-	result.Successful = err == nil
-	return result, err
+	// Check the scheduling attributes applied when the command starts
+	if err := validateScheduling(config); err != nil {
+		return nil, err
+	}
+	return cmd, nil
 }
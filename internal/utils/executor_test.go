@@ -216,3 +216,80 @@ func TestExecuteCommandError(t *testing.T) {
 		})
 	}
 }
+
+// TestExecuteCommandSeparateStreams tests that stdout and stderr are recorded separately
+func TestExecuteCommandSeparateStreams(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	var stdout, stderr strings.Builder
+	result, err := ExecuteCommand(CommandConfig{
+		Command: "sh",
+		Args:    []string{"-c", "echo out; echo err >&2"},
+		Stdout:  &stdout,
+		Stderr:  &stderr,
+	})
+	if err != nil {
+		t.Fatalf("ExecuteCommand() error = %v", err)
+	}
+
+	if string(result.Stdout) != "out\n" || string(result.Stderr) != "err\n" {
+		t.Errorf("Streams mismatch. Stdout: %q, Stderr: %q", result.Stdout, result.Stderr)
+	}
+	if stdout.String() != "out\n" || stderr.String() != "err\n" {
+		t.Errorf("Writers mismatch. Stdout: %q, Stderr: %q", stdout.String(), stderr.String())
+	}
+	if !strings.Contains(string(result.Output), "out\n") || !strings.Contains(string(result.Output), "err\n") {
+		t.Errorf("Combined output should contain both streams, got %q", result.Output)
+	}
+	for _, chunk := range result.Chunks {
+		if chunk.Time.IsZero() {
+			t.Errorf("Chunk %q has no timestamp", chunk.Data)
+		}
+	}
+}
+
+// TestExecuteCommandStream tests real time delivery of output lines
+func TestExecuteCommandStream(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	chunks := make(chan OutputChunk)
+	type lineAt struct {
+		line string
+		at   time.Time
+	}
+	var lines []lineAt
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for chunk := range chunks {
+			lines = append(lines, lineAt{chunk.Stream + ":" + string(chunk.Data), time.Now()})
+		}
+	}()
+
+	start := time.Now()
+	result, err := ExecuteCommandStream(CommandConfig{
+		Command:      "sh",
+		Args:         []string{"-c", "echo first; sleep 0.5; printf 'second\\nthird' >&2"},
+		LineBuffered: true,
+	}, chunks)
+	<-done
+	if err != nil {
+		t.Fatalf("ExecuteCommandStream() error = %v", err)
+	}
+
+	want := []string{"stdout:first\n", "stderr:second\n", "stderr:third"}
+	if len(lines) != len(want) {
+		t.Fatalf("Got lines %v, want %v", lines, want)
+	}
+	for i, w := range want {
+		if lines[i].line != w {
+			t.Errorf("Line %d = %q, want %q", i, lines[i].line, w)
+		}
+	}
+	if lines[0].at.Sub(start) >= 500*time.Millisecond {
+		t.Error("First line should be delivered before the command finishes")
+	}
+	if !result.Successful {
+		t.Error("Expected command to succeed")
+	}
+}
@@ -0,0 +1,519 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// CommandHandle controls a command started with StartCommand
+type CommandHandle struct {
+	config   CommandConfig
+	onOutput func(OutputChunk)
+	ctx      context.Context    // Lifetime of all attempts
+	cancel   context.CancelFunc // Cancels the running attempt and any retry
+	done     chan struct{}
+	result   *CommandResult
+	err      error
+
+	mu      sync.Mutex
+	current *commandRun // Attempt that is running or ran last
+}
+
+// commandRun is a single attempt of a command
+type commandRun struct {
+	cmd        *exec.Cmd
+	config     CommandConfig
+	ctx        context.Context
+	cancel     context.CancelFunc
+	collector  *outputCollector
+	terminator *groupTerminator
+	decider    *successDecider
+	result     *CommandResult
+	startErr   error         // Error starting the process (if any)
+	waitErr    error         // Error returned by cmd.Wait
+	exited     chan struct{} // Closed once the process was reaped
+
+	expecter    *expecter     // Output matcher of the expect steps (PTY only)
+	interacting chan struct{} // Closed once the expect steps have ended (PTY only)
+	expectErr   error         // Error of a failed expect step
+
+	watching     chan struct{} // Closed once the idle watchdog has ended (IdleTimeout only)
+	idleTimedOut bool          // Whether the idle watchdog terminated the command
+}
+
+// StartCommand starts a command in the background and returns a handle to
+// manage it. The command is run exactly as ExecuteCommand would run it,
+// including retries.
+func StartCommand(config CommandConfig) (*CommandHandle, error) {
+	return StartCommandContext(context.Background(), config)
+}
+
+// StartCommandContext is StartCommand with a context; cancelling ctx
+// terminates the command's process group and stops further retries
+func StartCommandContext(ctx context.Context, config CommandConfig) (*CommandHandle, error) {
+	h, err := startCommand(ctx, config, config.OnOutput)
+	if err != nil {
+		return nil, err
+	}
+
+	// Report start failures directly instead of through a finished handle;
+	// they are never retried
+	if err := h.run().startErr; err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// startCommand starts the first attempt. Errors in the configuration are
+// returned directly; a failed start yields a finished handle whose result
+// carries the error.
+func startCommand(ctx context.Context, config CommandConfig, onOutput func(OutputChunk)) (*CommandHandle, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	h := &CommandHandle{
+		config:   config,
+		onOutput: onOutput,
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+
+	run, err := startRun(ctx, config, onOutput)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	h.current = run
+
+	go h.loop(run)
+	return h, nil
+}
+
+// startRun prepares and starts one attempt of the command
+func startRun(parent context.Context, config CommandConfig, onOutput func(OutputChunk)) (*commandRun, error) {
+	// Create context with timeout
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if config.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, config.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(parent)
+	}
+	command := describeCommand(config)
+
+	decider, err := compileSuccessRules(config.Success)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	var script *scriptFile
+	var cgroup *transientCgroup
+	var box *sandbox
+	var gate *limitGate
+	release := func() {
+		cancel()
+		if cgroup != nil {
+			cgroup.started()
+			cgroup.remove()
+		}
+		if script != nil {
+			script.remove()
+		}
+		if box != nil {
+			box.remove()
+		}
+		if gate != nil {
+			gate.remove()
+		}
+	}
+
+	// Prepare the namespaces if requested
+	if config.Sandbox != nil {
+		b, err := newSandbox(config)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		box = b
+	}
+
+	// Run inline scripts from a private file; in a sandbox the file lives
+	// in the scratch directory, which is the only host directory replaced
+	if config.Script != "" {
+		var dir string
+		if box != nil {
+			dir = box.scratch
+		}
+		s, err := writeScript(config, dir)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		script = s
+		if box != nil {
+			script.path = box.inside(script.path)
+		}
+		config = script.apply(config)
+	}
+
+	cmd, err := prepareCommand(ctx, config)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	if box != nil {
+		if err := box.wrap(cmd); err != nil {
+			release()
+			return nil, err
+		}
+	}
+
+	// Hold the command back until its limits are applied; the sandbox
+	// helper does so for sandboxed commands
+	if !config.Limits.isZero() && box == nil {
+		if gate, err = newLimitGate(cmd); err != nil {
+			release()
+			return nil, err
+		}
+	}
+
+	// Run in a separate process group that is terminated as a whole
+	terminator := newGroupTerminator(cmd, config)
+
+	// Place the command in its own cgroup if requested
+	if config.Cgroup != nil {
+		if cgroup, err = newTransientCgroup(config.Cgroup); err != nil {
+			release()
+			return nil, err
+		}
+		cgroup.attach(cmd)
+		terminator.cgroup = cgroup
+	}
+
+	// Feed the configured input
+	stdin, err := attachStdin(cmd, config)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	// Collect both streams separately while they are produced, or the
+	// terminal output when running on a pseudo-terminal
+	collector := newOutputCollector(config, onOutput)
+	var term *terminal
+	var patterns []*regexp.Regexp
+	if config.PTY != nil {
+		if patterns, err = compileExpect(config.PTY.Expect); err == nil {
+			term, err = openTerminal(config.PTY)
+		}
+		if err == nil {
+			if err = collector.attachTerminal(cmd, term); err != nil {
+				term.master.Close()
+				term.slave.Close()
+			}
+		}
+		if err != nil {
+			stdin.start(false)
+			release()
+			return nil, err
+		}
+	} else if err := collector.attach(cmd); err != nil {
+		stdin.start(false)
+		release()
+		return nil, err
+	}
+
+	run := &commandRun{
+		cmd:        cmd,
+		config:     config,
+		ctx:        ctx,
+		cancel:     cancel,
+		collector:  collector,
+		terminator: terminator,
+		decider:    decider,
+		exited:     make(chan struct{}),
+		result: &CommandResult{
+			Command:    command,
+			TimedOut:   false,
+			Successful: false,
+			ExitCode:   -1,
+		},
+	}
+
+	// Execute the command
+	run.startErr = startProcess(cmd, config)
+	if box != nil {
+		run.startErr = box.setUp(cmd, run.startErr)
+	}
+	if gate != nil {
+		run.startErr = gate.started(cmd, run.startErr)
+	}
+	if cgroup != nil {
+		cgroup.started()
+	}
+	if run.startErr == nil && !config.Limits.isZero() {
+		if err := applyLimits(cmd.Process.Pid, config.Limits); err != nil {
+			// Never run a command without its limits
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			cmd.Wait()
+			run.startErr = err
+		}
+	}
+	if box != nil {
+		run.startErr = box.release(cmd, run.startErr)
+	}
+	if gate != nil {
+		run.startErr = gate.release(cmd, run.startErr)
+		gate.remove()
+	}
+	stdin.start(run.startErr == nil)
+	if term != nil && len(patterns) > 0 {
+		run.expecter = newExpecter()
+		collector.expecter = run.expecter
+	}
+	collector.start()
+	if run.startErr != nil {
+		if cgroup != nil {
+			cgroup.remove()
+		}
+		if script != nil {
+			script.remove()
+		}
+		if box != nil {
+			box.remove()
+		}
+		close(run.exited)
+		return run, nil
+	}
+	run.result.StartTime = time.Now()
+
+	if config.IdleTimeout > 0 {
+		run.watching = make(chan struct{})
+		go func() {
+			defer close(run.watching)
+			run.idleTimedOut = run.watchIdle(config.IdleTimeout)
+		}()
+	}
+
+	if run.expecter != nil {
+		run.interacting = make(chan struct{})
+		go func() {
+			defer close(run.interacting)
+			run.expectErr = run.interact(term, config.PTY.Expect, patterns)
+		}()
+	}
+
+	go func() {
+		defer close(run.exited)
+		run.waitErr = cmd.Wait()
+		terminator.finish()
+		stdin.close()
+		run.result.EndTime = time.Now()
+		run.result.Duration = run.result.EndTime.Sub(run.result.StartTime)
+		fillProcessState(run.result, cmd.ProcessState)
+		if box != nil {
+			run.waitErr = box.finish(run.result, run.waitErr)
+		}
+		if cgroup != nil {
+			// Removal kills processes the command left behind
+			run.result.OOMKilled = cgroup.oomKilled()
+			cgroup.remove()
+		}
+		if script != nil {
+			script.remove()
+		}
+		if box != nil {
+			box.remove()
+		}
+	}()
+	return run, nil
+}
+
+// wait waits for the attempt, drains its output and completes its result
+func (r *commandRun) wait() (*CommandResult, error) {
+	defer r.cancel()
+	<-r.exited
+
+	err := r.startErr
+	if err == nil {
+		err = r.waitErr
+	}
+	r.collector.wait(r.terminator.drainTimeout())
+	if err == nil {
+		err = r.collector.spillErr
+	}
+	if r.interacting != nil {
+		<-r.interacting
+	}
+	if r.watching != nil {
+		<-r.watching
+	}
+
+	result := r.result
+	result.ExecError = err
+	r.collector.fill(result)
+
+	// Check for timeout
+	if errors.Is(r.ctx.Err(), context.DeadlineExceeded) {
+		result.TimedOut = true
+		if r.config.Timeout > 0 {
+			result.ExecError = fmt.Errorf("command timed out after %v", r.config.Timeout)
+		} else {
+			result.ExecError = fmt.Errorf("command timed out: %w", context.DeadlineExceeded)
+		}
+		return result, result.ExecError
+	}
+
+	// Check for an idle timeout, which cancels the command
+	if r.idleTimedOut {
+		result.IdleTimedOut = true
+		result.ExecError = fmt.Errorf("command produced no output for %v", r.config.IdleTimeout)
+		return result, result.ExecError
+	}
+
+	// Check for a failed interaction, which cancels the command
+	if r.expectErr != nil {
+		result.ExecError = r.expectErr
+		return result, result.ExecError
+	}
+
+	// Check for cancellation
+	if errors.Is(r.ctx.Err(), context.Canceled) && r.startErr == nil && err != nil {
+		result.Canceled = true
+		result.ExecError = fmt.Errorf("command canceled: %w", context.Canceled)
+		return result, result.ExecError
+	}
+
+	result.LimitExceeded = limitExceeded(r.config.Limits, result)
+
+	// Decide success by exit code and output; failures to start the command
+	// or to spill its output are never overridden
+	if r.startErr == nil && r.collector.spillErr == nil {
+		err = r.decider.decide(result, err)
+		result.ExecError = err
+	}
+	result.Successful = err == nil
+	return result, err
+}
+
+// loop waits for each attempt and starts the next one as the retry policy allows
+func (h *CommandHandle) loop(run *commandRun) {
+	defer close(h.done)
+	defer h.cancel()
+
+	policy := h.config.Retry
+	var attempts []AttemptRecord
+	for attempt := 1; ; attempt++ {
+		result, err := run.wait()
+		attempts = append(attempts, newAttemptRecord(attempt, result))
+
+		retry := attempt < policy.MaxAttempts && policy.shouldRetry(result) && h.ctx.Err() == nil
+		if retry {
+			delay := policy.backoff(attempt)
+			attempts[len(attempts)-1].Backoff = delay
+
+			select {
+			case <-time.After(delay):
+			case <-h.ctx.Done():
+				// The command ends with the backoff rather than the attempt
+				retry = false
+				if errors.Is(h.ctx.Err(), context.Canceled) {
+					result.Canceled = true
+					err = fmt.Errorf("command canceled: %w", context.Canceled)
+				} else {
+					result.TimedOut = true
+					err = fmt.Errorf("command timed out: %w", context.DeadlineExceeded)
+				}
+				result.ExecError = err
+			}
+		}
+		if !retry {
+			h.complete(result, err, attempts)
+			return
+		}
+
+		next, startErr := startRun(h.ctx, h.config, h.onOutput)
+		if startErr != nil {
+			result.ExecError = startErr
+			h.complete(result, startErr, attempts)
+			return
+		}
+		h.mu.Lock()
+		h.current = next
+		h.mu.Unlock()
+		run = next
+	}
+}
+
+// complete publishes the final result
+func (h *CommandHandle) complete(result *CommandResult, err error, attempts []AttemptRecord) {
+	result.Attempts = attempts
+	h.result = result
+	h.err = err
+}
+
+// run returns the attempt that is running or ran last
+func (h *CommandHandle) run() *commandRun {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.current
+}
+
+// PID returns the process ID of the current attempt, which is also its
+// process group ID
+func (h *CommandHandle) PID() int {
+	cmd := h.run().cmd
+	if cmd.Process == nil {
+		return 0
+	}
+	return cmd.Process.Pid
+}
+
+// Wait blocks until the command has finished and returns its result
+func (h *CommandHandle) Wait() (*CommandResult, error) {
+	<-h.done
+	return h.result, h.err
+}
+
+// Done returns a channel that is closed when the command has finished
+func (h *CommandHandle) Done() <-chan struct{} {
+	return h.done
+}
+
+// Signal sends sig to the process group of the current attempt
+func (h *CommandHandle) Signal(sig syscall.Signal) error {
+	run := h.run()
+	select {
+	case <-run.exited:
+		return fmt.Errorf("command already finished")
+	default:
+	}
+	return syscall.Kill(-h.PID(), sig)
+}
+
+// Cancel terminates the command with the configured kill signal and grace
+// period and stops further retries; the result reports Canceled
+func (h *CommandHandle) Cancel() {
+	h.cancel()
+}
+
+// Output returns the combined output of the current attempt produced so far
+func (h *CommandHandle) Output() []byte {
+	return h.run().collector.snapshot("")
+}
+
+// Stdout returns the standard output of the current attempt produced so far
+func (h *CommandHandle) Stdout() []byte {
+	return h.run().collector.snapshot(StreamStdout)
+}
+
+// Stderr returns the standard error of the current attempt produced so far
+func (h *CommandHandle) Stderr() []byte {
+	return h.run().collector.snapshot(StreamStderr)
+}
@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"context"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestStartCommand tests PID, live output and Wait of a background command
+func TestStartCommand(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	h, err := StartCommand(CommandConfig{
+		Command: "sh",
+		Args:    []string{"-c", "echo started; sleep 0.3; echo finished"},
+	})
+	if err != nil {
+		t.Fatalf("StartCommand() error = %v", err)
+	}
+	if h.PID() <= 0 {
+		t.Errorf("PID() = %d, want a positive pid", h.PID())
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(string(h.Stdout()), "started") {
+		if time.Now().After(deadline) {
+			t.Fatal("Live output was not available while running")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case <-h.Done():
+		t.Fatal("Done() should not be closed while running")
+	default:
+	}
+
+	result, err := h.Wait()
+	if err != nil || !result.Successful {
+		t.Fatalf("Wait() = %+v, %v", result, err)
+	}
+	if string(h.Output()) != "started\nfinished\n" {
+		t.Errorf("Output() = %q", h.Output())
+	}
+	if err := h.Signal(syscall.SIGTERM); err == nil {
+		t.Error("Signal() after finish should return error")
+	}
+}
+
+// TestStartCommandCancel tests cancelling a running command through its handle
+func TestStartCommandCancel(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	h, err := StartCommand(CommandConfig{Command: "sleep", Args: []string{"30"}})
+	if err != nil {
+		t.Fatalf("StartCommand() error = %v", err)
+	}
+	h.Cancel()
+
+	select {
+	case <-h.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Command was not terminated after Cancel")
+	}
+
+	result, err := h.Wait()
+	if err == nil || !result.Canceled || result.TimedOut || result.Successful {
+		t.Errorf("Unexpected result after cancel: %+v, %v", result, err)
+	}
+	if !strings.Contains(err.Error(), "command canceled") {
+		t.Errorf("Error = %q, want cancellation error", err)
+	}
+}
+
+// TestStartCommandSignal tests sending a signal through the handle
+func TestStartCommandSignal(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	h, err := StartCommand(CommandConfig{Command: "sleep", Args: []string{"30"}})
+	if err != nil {
+		t.Fatalf("StartCommand() error = %v", err)
+	}
+	if err := h.Signal(syscall.SIGUSR1); err != nil {
+		t.Fatalf("Signal() error = %v", err)
+	}
+
+	result, _ := h.Wait()
+	if result.Signal != "SIGUSR1" || result.Canceled {
+		t.Errorf("Unexpected result: signal %q canceled %v", result.Signal, result.Canceled)
+	}
+}
+
+// TestStartCommandStartError tests that start failures are returned directly
+func TestStartCommandStartError(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	h, err := StartCommand(CommandConfig{Command: "/non-existent-command"})
+	if err == nil || h != nil {
+		t.Fatalf("Expected start error, got handle %v err %v", h, err)
+	}
+}
+
+// TestExecuteCommandContext tests cancellation through the caller's context
+func TestExecuteCommandContext(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	result, err := ExecuteCommandContext(ctx, CommandConfig{Command: "sleep", Args: []string{"30"}})
+	if err == nil || !result.TimedOut {
+		t.Errorf("Expected parent deadline to time out the command: %+v, %v", result, err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	result, err = ExecuteCommandContext(ctx, CommandConfig{Command: "sleep", Args: []string{"30"}})
+	if err == nil || !result.Canceled {
+		t.Errorf("Expected cancellation: %+v, %v", result, err)
+	}
+}
@@ -0,0 +1,28 @@
+package utils
+
+import "time"
+
+// watchIdle terminates the command once it has produced no output for
+// timeout, like a timeout does, and reports whether it did. It returns
+// when the command has exited or was terminated for another reason.
+func (r *commandRun) watchIdle(timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+		case <-r.exited:
+			return false
+		case <-r.ctx.Done():
+			return false
+		}
+
+		idle := time.Since(r.collector.lastActivity())
+		if idle >= timeout {
+			r.cancel()
+			return true
+		}
+		timer.Reset(timeout - idle)
+	}
+}
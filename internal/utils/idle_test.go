@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestExecuteCommandIdleTimeout tests that silent commands are terminated
+// while commands producing output may run longer than the idle timeout
+func TestExecuteCommandIdleTimeout(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	tests := []struct {
+		name         string
+		script       string
+		timeout      time.Duration
+		wantSuccess  bool
+		wantIdle     bool
+		wantTimedOut bool
+		wantErr      string
+	}{
+		{
+			name:     "Silent",
+			script:   "sleep 5",
+			wantIdle: true,
+			wantErr:  "command produced no output for 300ms",
+		},
+		{
+			name:     "Silent after output",
+			script:   "echo started; sleep 5",
+			wantIdle: true,
+			wantErr:  "command produced no output for 300ms",
+		},
+		{
+			name:        "Steady stdout",
+			script:      "for i in 1 2 3 4 5 6; do echo $i; sleep 0.1; done",
+			wantSuccess: true,
+		},
+		{
+			name:        "Steady stderr",
+			script:      "for i in 1 2 3 4 5 6; do echo $i >&2; sleep 0.1; done",
+			wantSuccess: true,
+		},
+		{
+			name:         "Total timeout",
+			script:       "while :; do echo x; sleep 0.1; done",
+			timeout:      500 * time.Millisecond,
+			wantTimedOut: true,
+			wantErr:      "command timed out after 500ms",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			result, err := ExecuteCommand(CommandConfig{
+				Command:     "sh",
+				Args:        []string{"-c", tt.script},
+				Timeout:     tt.timeout,
+				IdleTimeout: 300 * time.Millisecond,
+				GracePeriod: 100 * time.Millisecond,
+			})
+			if result.Successful != tt.wantSuccess || result.IdleTimedOut != tt.wantIdle || result.TimedOut != tt.wantTimedOut {
+				t.Errorf("Successful = %v, IdleTimedOut = %v, TimedOut = %v, want %v, %v, %v (error %v)",
+					result.Successful, result.IdleTimedOut, result.TimedOut, tt.wantSuccess, tt.wantIdle, tt.wantTimedOut, err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("ExecuteCommand() error = %v, want %q", err, tt.wantErr)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("ExecuteCommand() took %v", elapsed)
+			}
+		})
+	}
+}
+
+// TestExecuteCommandIdleTimeoutRetry tests that idle timeouts are retried
+// like timeouts
+func TestExecuteCommandIdleTimeoutRetry(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	result, err := ExecuteCommand(CommandConfig{
+		Command:     "sleep",
+		Args:        []string{"5"},
+		IdleTimeout: 100 * time.Millisecond,
+		GracePeriod: 100 * time.Millisecond,
+		Retry:       RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond, RetryOnTimeout: true},
+	})
+	if err == nil || !strings.Contains(err.Error(), "no output") {
+		t.Errorf("ExecuteCommand() error = %v, want idle timeout", err)
+	}
+	if len(result.Attempts) != 2 {
+		t.Fatalf("len(Attempts) = %d, want 2", len(result.Attempts))
+	}
+	for _, attempt := range result.Attempts {
+		if !attempt.IdleTimedOut || attempt.TimedOut {
+			t.Errorf("Attempt %d IdleTimedOut = %v, TimedOut = %v, want idle timeout only", attempt.Attempt, attempt.IdleTimedOut, attempt.TimedOut)
+		}
+	}
+}
+
+// TestExecutePipelineIdleTimeout tests the idle timeout of the last stage,
+// whose output is observed
+func TestExecutePipelineIdleTimeout(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	result, err := ExecutePipeline(PipelineConfig{Stages: []CommandConfig{
+		{Command: "sh", Args: []string{"-c", "echo a; exec sleep 1"}},
+		{Command: "cat", IdleTimeout: 200 * time.Millisecond, GracePeriod: 100 * time.Millisecond},
+	}})
+	if err == nil || !result.Stages[1].IdleTimedOut {
+		t.Fatalf("ExecutePipeline() error = %v, want idle timeout of stage 2", err)
+	}
+	if string(result.Output) != "a\n" {
+		t.Errorf("Output = %q, want %q", result.Output, "a\n")
+	}
+}
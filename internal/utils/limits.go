@@ -0,0 +1,47 @@
+package utils
+
+import "time"
+
+// ResourceLimits holds the rlimits applied to an executed command. Zero
+// values leave the inherited limit unchanged. Limits are applied before the
+// command's executable runs, so they also hold for every child it forks.
+type ResourceLimits struct {
+	AddressSpace uint64        // RLIMIT_AS: max virtual memory in bytes
+	CPUTime      time.Duration // RLIMIT_CPU: max CPU time, rounded up to whole seconds
+	OpenFiles    uint64        // RLIMIT_NOFILE: max number of open file descriptors
+	Processes    uint64        // RLIMIT_NPROC: max number of processes of the user, not only of the command
+	FileSize     uint64        // RLIMIT_FSIZE: max size of a written file in bytes
+	CoreSize     *uint64       // RLIMIT_CORE: max core dump size in bytes (0 disables core dumps)
+}
+
+// isZero reports whether no limit is set
+func (l ResourceLimits) isZero() bool {
+	return l == ResourceLimits{}
+}
+
+// limitExceeded names the limit that terminated the command, or returns ""
+// when the termination cannot be attributed to a limit. Exhausted memory,
+// file descriptors or processes surface as failing system calls inside the
+// command and are not detected.
+func limitExceeded(limits ResourceLimits, result *CommandResult) string {
+	if result.TimedOut || result.Canceled {
+		return ""
+	}
+
+	switch result.Signal {
+	case "SIGXCPU":
+		if limits.CPUTime > 0 {
+			return "RLIMIT_CPU"
+		}
+	case "SIGXFSZ":
+		if limits.FileSize > 0 {
+			return "RLIMIT_FSIZE"
+		}
+	case "SIGKILL":
+		// The hard CPU limit is enforced with SIGKILL
+		if limits.CPUTime > 0 && result.Usage != nil && result.Usage.UserCPU+result.Usage.SystemCPU >= limits.CPUTime {
+			return "RLIMIT_CPU"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,231 @@
+//go:build linux
+
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// The limit gate is this executable, re-executed with limitGateArg0 and the
+// command in limitGateEnv
+const (
+	limitGateArg0 = "gojob-limits"
+	limitGateEnv  = "GOJOB_LIMITS_SPEC"
+)
+
+// File descriptors of the pipes between the calling process and the gate
+const (
+	limitGateControlFd = 3 // Closed by the caller once the limits are applied
+	limitGateReportFd  = 4 // Ready byte, then the error of a failed exec; closed by a successful one
+)
+
+// limitGate holds a command back until its limits are applied. The process
+// is started as a helper that waits for the caller and then replaces itself
+// with the command, so the limits apply from the command's first
+// instruction and are inherited by all its children.
+type limitGate struct {
+	control   *os.File   // Caller's end of the control pipe
+	report    *os.File   // Caller's end of the report pipe
+	childEnds []*os.File // Helper's ends of the pipes, closed once it started
+}
+
+// limitGateSpec is the command the gate replaces itself with
+type limitGateSpec struct {
+	Path string   // Executable of the command
+	Args []string // Arguments of the command including argv[0]
+}
+
+// init turns the process into the limit gate when it was re-executed for a
+// command with limits, and never returns in that case
+func init() {
+	if encoded, ok := os.LookupEnv(limitGateEnv); ok && len(os.Args) == 1 && os.Args[0] == limitGateArg0 {
+		os.Exit(runLimitGate(encoded))
+	}
+}
+
+// newLimitGate changes cmd to start the gate, which executes the original
+// command once release is called
+func newLimitGate(cmd *exec.Cmd) (*limitGate, error) {
+	g := &limitGate{}
+	if cmd.Err != nil {
+		return g, nil // Start reports the failed lookup
+	}
+
+	encoded, err := json.Marshal(limitGateSpec{Path: cmd.Path, Args: cmd.Args})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode command: %w", err)
+	}
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+
+	controlR, controlW, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create limits pipe: %w", err)
+	}
+	reportR, reportW, err := os.Pipe()
+	if err != nil {
+		controlR.Close()
+		controlW.Close()
+		return nil, fmt.Errorf("failed to create limits pipe: %w", err)
+	}
+	g.control, g.report = controlW, reportR
+	g.childEnds = []*os.File{controlR, reportW}
+
+	cmd.Path = "/proc/self/exe"
+	cmd.Args = []string{limitGateArg0}
+	cmd.Env = append(env[:len(env):len(env)], limitGateEnv+"="+string(encoded))
+	cmd.ExtraFiles = g.childEnds
+	return g, nil
+}
+
+// started is called after the gate was started and waits until it is
+// ready to have its limits applied, as the runtime of the helper may fail
+// to start under them
+func (g *limitGate) started(cmd *exec.Cmd, startErr error) error {
+	for _, f := range g.childEnds {
+		f.Close()
+	}
+	g.childEnds = nil
+	if startErr != nil || g.report == nil {
+		return startErr
+	}
+
+	if _, err := io.ReadFull(g.report, make([]byte, 1)); err != nil {
+		cmd.Wait()
+		return fmt.Errorf("limit gate exited unexpectedly: %w", err)
+	}
+	return nil
+}
+
+// release lets the gate execute the command, which inherits the limits the
+// caller applied in between, and waits for the exec
+func (g *limitGate) release(cmd *exec.Cmd, startErr error) error {
+	if g.control == nil {
+		return startErr
+	}
+	g.control.Close()
+	if startErr != nil {
+		return startErr
+	}
+
+	msg, err := io.ReadAll(g.report)
+	if err == nil && len(msg) > 0 {
+		err = fmt.Errorf("failed to start command: %s", msg)
+	}
+	if err != nil {
+		cmd.Wait()
+		return err
+	}
+	return nil
+}
+
+// remove closes the pipes
+func (g *limitGate) remove() {
+	for _, f := range append(g.childEnds, g.control, g.report) {
+		if f != nil {
+			f.Close()
+		}
+	}
+}
+
+// runLimitGate is the limit gate. It waits until the caller has applied the
+// limits and executes the command, returning only if that fails.
+func runLimitGate(encoded string) int {
+	syscall.CloseOnExec(limitGateControlFd)
+	syscall.CloseOnExec(limitGateReportFd)
+	report := os.NewFile(limitGateReportFd, "report")
+	os.Unsetenv(limitGateEnv)
+
+	var spec limitGateSpec
+	if err := json.Unmarshal([]byte(encoded), &spec); err != nil {
+		fmt.Fprintf(report, "invalid command spec: %v", err)
+		return 127
+	}
+	path, err := syscall.BytePtrFromString(spec.Path)
+	if err != nil {
+		fmt.Fprintf(report, "invalid command path: %v", err)
+		return 127
+	}
+	argv, err := syscall.SlicePtrFromStrings(spec.Args)
+	if err != nil {
+		fmt.Fprintf(report, "invalid command arguments: %v", err)
+		return 127
+	}
+	envv, err := syscall.SlicePtrFromStrings(os.Environ())
+	if err != nil {
+		fmt.Fprintf(report, "invalid command environment: %v", err)
+		return 127
+	}
+
+	// Once the limits are applied the runtime may fail to map memory or
+	// create threads, so neither the wait for the caller to close the
+	// control pipe nor the exec goes through it
+	var buf [1]byte
+	if _, err := report.Write(buf[:]); err != nil {
+		return 127
+	}
+	for {
+		n, _, errno := unix.RawSyscall(unix.SYS_READ, limitGateControlFd, uintptr(unsafe.Pointer(&buf[0])), 1)
+		if n == 0 || errno != 0 && errno != unix.EINTR {
+			break
+		}
+	}
+	_, _, errno := unix.RawSyscall(unix.SYS_EXECVE, uintptr(unsafe.Pointer(path)),
+		uintptr(unsafe.Pointer(&argv[0])), uintptr(unsafe.Pointer(&envv[0])))
+	err = errno
+	report.WriteString(err.Error())
+	return 127
+}
+
+// applyLimits sets the configured rlimits on the process pid
+func applyLimits(pid int, limits ResourceLimits) error {
+	type rlimit struct {
+		name     string
+		resource int
+		value    uint64
+	}
+	var set []rlimit
+	add := func(name string, resource int, value uint64) {
+		if value > 0 {
+			set = append(set, rlimit{name, resource, value})
+		}
+	}
+	add("RLIMIT_AS", unix.RLIMIT_AS, limits.AddressSpace)
+	add("RLIMIT_NOFILE", unix.RLIMIT_NOFILE, limits.OpenFiles)
+	add("RLIMIT_NPROC", unix.RLIMIT_NPROC, limits.Processes)
+	add("RLIMIT_FSIZE", unix.RLIMIT_FSIZE, limits.FileSize)
+
+	for _, l := range set {
+		if err := unix.Prlimit(pid, l.resource, &unix.Rlimit{Cur: l.value, Max: l.value}, nil); err != nil {
+			return fmt.Errorf("failed to set %s: %w", l.name, err)
+		}
+	}
+
+	if limits.CoreSize != nil {
+		core := *limits.CoreSize
+		if err := unix.Prlimit(pid, unix.RLIMIT_CORE, &unix.Rlimit{Cur: core, Max: core}, nil); err != nil {
+			return fmt.Errorf("failed to set RLIMIT_CORE: %w", err)
+		}
+	}
+
+	if limits.CPUTime > 0 {
+		// SIGXCPU at the soft limit, SIGKILL one second later for commands
+		// that handle it
+		secs := uint64((limits.CPUTime + time.Second - 1) / time.Second)
+		if err := unix.Prlimit(pid, unix.RLIMIT_CPU, &unix.Rlimit{Cur: secs, Max: secs + 1}, nil); err != nil {
+			return fmt.Errorf("failed to set RLIMIT_CPU: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+package utils
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// limitGate is not supported outside Linux
+type limitGate struct{}
+
+// newLimitGate always fails outside Linux
+func newLimitGate(cmd *exec.Cmd) (*limitGate, error) {
+	return nil, errors.New("resource limits are only supported on Linux")
+}
+
+func (g *limitGate) started(cmd *exec.Cmd, startErr error) error { return startErr }
+func (g *limitGate) release(cmd *exec.Cmd, startErr error) error { return startErr }
+func (g *limitGate) remove()                                     {}
+
+// applyLimits is only supported on Linux
+func applyLimits(pid int, limits ResourceLimits) error {
+	return errors.New("resource limits are only supported on Linux")
+}
@@ -0,0 +1,193 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestExecuteCommandLimits tests that limits are visible to the command
+func TestExecuteCommandLimits(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("Skipping test on %s platform, expect: linux", runtime.GOOS)
+	}
+	defaultLooker = &MockUserLooker{}
+	noCore := uint64(0)
+
+	tests := []struct {
+		name    string
+		limits  ResourceLimits
+		query   string
+		wantOut string
+	}{
+		{
+			name:    "Open files",
+			limits:  ResourceLimits{OpenFiles: 64},
+			query:   "ulimit -n",
+			wantOut: "64\n",
+		},
+		{
+			name:    "File size",
+			limits:  ResourceLimits{FileSize: 512 * 1024},
+			query:   "ulimit -f",
+			wantOut: "1024\n", // In 512 byte blocks
+		},
+		{
+			name:    "Core size",
+			limits:  ResourceLimits{CoreSize: &noCore},
+			query:   "ulimit -c",
+			wantOut: "0\n",
+		},
+		{
+			name:    "CPU time rounded up",
+			limits:  ResourceLimits{CPUTime: 1500 * time.Millisecond},
+			query:   "ulimit -t",
+			wantOut: "2\n",
+		},
+		{
+			name:    "Child started right away",
+			limits:  ResourceLimits{OpenFiles: 64},
+			query:   "exec sh -c 'ulimit -n' & wait",
+			wantOut: "64\n",
+		},
+		{
+			name:    "Address space",
+			limits:  ResourceLimits{AddressSpace: 1 << 30},
+			query:   "ulimit -v",
+			wantOut: "1048576\n", // In kilobytes
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ExecuteCommand(CommandConfig{
+				Command: "sh",
+				Args:    []string{"-c", tt.query},
+				Limits:  tt.limits,
+			})
+			if err != nil {
+				t.Fatalf("ExecuteCommand() error = %v", err)
+			}
+			if string(result.Output) != tt.wantOut {
+				t.Errorf("Output = %q, want %q", result.Output, tt.wantOut)
+			}
+			if result.LimitExceeded != "" {
+				t.Errorf("LimitExceeded = %q, want none", result.LimitExceeded)
+			}
+		})
+	}
+}
+
+// TestExecuteCommandLimitExceeded tests reporting of limits that terminated
+// the command
+func TestExecuteCommandLimitExceeded(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("Skipping test on %s platform, expect: linux", runtime.GOOS)
+	}
+	defaultLooker = &MockUserLooker{}
+	out := filepath.Join(t.TempDir(), "out")
+
+	tests := []struct {
+		name       string
+		limits     ResourceLimits
+		script     string
+		wantSignal string
+		wantLimit  string
+	}{
+		{
+			name:       "CPU time",
+			limits:     ResourceLimits{CPUTime: time.Second},
+			script:     "while :; do :; done",
+			wantSignal: "SIGXCPU",
+			wantLimit:  "RLIMIT_CPU",
+		},
+		{
+			name:       "File size",
+			limits:     ResourceLimits{FileSize: 4096},
+			script:     "exec head -c 100000 /dev/zero > " + out,
+			wantSignal: "SIGXFSZ",
+			wantLimit:  "RLIMIT_FSIZE",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ExecuteCommand(CommandConfig{
+				Command: "sh",
+				Args:    []string{"-c", tt.script},
+				Limits:  tt.limits,
+				Timeout: 10 * time.Second,
+			})
+			if err == nil || result.Successful {
+				t.Fatal("ExecuteCommand() should fail")
+			}
+			if result.Signal != tt.wantSignal {
+				t.Errorf("Signal = %q, want %q", result.Signal, tt.wantSignal)
+			}
+			if result.LimitExceeded != tt.wantLimit {
+				t.Errorf("LimitExceeded = %q, want %q", result.LimitExceeded, tt.wantLimit)
+			}
+		})
+	}
+}
+
+// TestExecuteCommandLimitsStart tests that commands with limits keep their
+// process ID and report failures to execute them
+func TestExecuteCommandLimitsStart(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("Skipping test on %s platform, expect: linux", runtime.GOOS)
+	}
+	defaultLooker = &MockUserLooker{}
+	limits := ResourceLimits{OpenFiles: 64}
+
+	h, err := StartCommand(CommandConfig{Command: "sh", Args: []string{"-c", "echo $$"}, Limits: limits})
+	if err != nil {
+		t.Fatalf("StartCommand() error = %v", err)
+	}
+	pid := h.PID()
+	result, err := h.Wait()
+	if err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	if got := strings.TrimSpace(string(result.Output)); got != strconv.Itoa(pid) {
+		t.Errorf("Command PID = %s, want %d", got, pid)
+	}
+
+	// An executable file in no known format fails in the gate's exec
+	bogus := filepath.Join(t.TempDir(), "bogus")
+	os.WriteFile(bogus, []byte{0, 1, 2, 3}, 0755)
+	_, err = ExecuteCommand(CommandConfig{Command: bogus, Limits: limits})
+	if err == nil || !strings.Contains(err.Error(), "exec format error") {
+		t.Errorf("ExecuteCommand() error = %v, want exec format error", err)
+	}
+}
+
+// TestLimitExceeded tests attribution of terminations to limits
+func TestLimitExceeded(t *testing.T) {
+	cpu := ResourceLimits{CPUTime: time.Second}
+	tests := []struct {
+		name   string
+		limits ResourceLimits
+		result CommandResult
+		want   string
+	}{
+		{"No limits", ResourceLimits{}, CommandResult{Signal: "SIGXCPU"}, ""},
+		{"CPU soft limit", cpu, CommandResult{Signal: "SIGXCPU"}, "RLIMIT_CPU"},
+		{"CPU hard limit", cpu, CommandResult{Signal: "SIGKILL", Usage: &ResourceUsage{UserCPU: 2 * time.Second}}, "RLIMIT_CPU"},
+		{"Killed below CPU limit", cpu, CommandResult{Signal: "SIGKILL", Usage: &ResourceUsage{UserCPU: time.Millisecond}}, ""},
+		{"Killed on timeout", cpu, CommandResult{Signal: "SIGKILL", TimedOut: true, Usage: &ResourceUsage{UserCPU: 2 * time.Second}}, ""},
+		{"File size", ResourceLimits{FileSize: 1}, CommandResult{Signal: "SIGXFSZ"}, "RLIMIT_FSIZE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := limitExceeded(tt.limits, &tt.result); got != tt.want {
+				t.Errorf("limitExceeded() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
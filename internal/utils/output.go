@@ -0,0 +1,341 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Output stream names used in OutputChunk
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// OutputChunk is a piece of command output as it was produced
+type OutputChunk struct {
+	Stream string    `json:"stream"` // StreamStdout or StreamStderr
+	Data   []byte    `json:"data"`   // Raw bytes, or one line including its newline in line mode
+	Time   time.Time `json:"time"`   // When the data was read from the command
+}
+
+// outputCollector records command output per stream and forwards it to the
+// configured writers and callback as it arrives
+type outputCollector struct {
+	mu       sync.Mutex
+	delivery sync.Mutex      // Serialises the writers and the callback, which run outside mu
+	pending  []pendingOutput // Output recorded but not yet forwarded
+	combined *cappedBuffer
+	stdout   *cappedBuffer
+	stderr   *cappedBuffer
+	chunks   []OutputChunk
+	chunkCap int                  // Max bytes recorded in chunks, 0 for unlimited
+	chunkLen int                  // Bytes recorded in chunks
+	dropped  bool                 // Whether chunks were dropped
+	writers  map[string]io.Writer // Real time destinations per stream
+	onOutput func(OutputChunk)    // Real time callback (optional)
+	lines    bool                 // Deliver complete lines to onOutput
+	partial  map[string][]byte    // Incomplete trailing line per stream (line mode)
+
+	pipes    map[string][2]*os.File // Read and write end of the pipe per stream
+	copying  sync.WaitGroup         // Running pipe readers
+	redirect *os.File               // Replaces the stdout pipe, e.g. to feed a pipeline stage (optional)
+	expecter *expecter              // Receives the output for expect steps (optional)
+	lastRead time.Time              // When output was last read, or the command started
+
+	command  string     // Command name, used to name the spill file
+	spillDir string     // Directory of the spill file (optional)
+	spill    *spillFile // Receives the complete combined output (optional)
+	spillErr error      // Error writing the spill file (if any)
+}
+
+// pendingOutput is recorded output that is yet to be forwarded
+type pendingOutput struct {
+	writer io.Writer     // Receives data (optional)
+	data   []byte        // Raw output for writer
+	chunks []OutputChunk // Chunks for the callback, lines in line mode
+}
+
+// newOutputCollector creates a collector for the streaming options of config
+func newOutputCollector(config CommandConfig, onOutput func(OutputChunk)) *outputCollector {
+	return &outputCollector{
+		combined: newCappedBuffer(config),
+		stdout:   newCappedBuffer(config),
+		stderr:   newCappedBuffer(config),
+		chunkCap: config.MaxOutputBytes,
+		writers: map[string]io.Writer{
+			StreamStdout: config.Stdout,
+			StreamStderr: config.Stderr,
+		},
+		onOutput: onOutput,
+		lines:    config.LineBuffered,
+		partial:  make(map[string][]byte),
+		pipes:    make(map[string][2]*os.File),
+		command:  config.Command,
+		spillDir: config.SpillDir,
+		redirect: config.stdoutPipe,
+	}
+}
+
+// attach connects stdout and stderr of cmd to pipes owned by the collector,
+// so output can be drained independently of cmd.Wait, and creates the spill
+// file if one was requested
+func (c *outputCollector) attach(cmd *exec.Cmd) error {
+	if err := c.openSpill(); err != nil {
+		return err
+	}
+
+	for _, stream := range []string{StreamStdout, StreamStderr} {
+		if stream == StreamStdout && c.redirect != nil {
+			continue
+		}
+		r, w, err := os.Pipe()
+		if err != nil {
+			c.closePipes()
+			if c.spill != nil {
+				c.spill.Close()
+				os.Remove(c.spill.path)
+			}
+			return fmt.Errorf("failed to create %s pipe: %w", stream, err)
+		}
+		c.pipes[stream] = [2]*os.File{r, w}
+	}
+	cmd.Stdout = c.pipes[StreamStdout][1]
+	if c.redirect != nil {
+		cmd.Stdout = c.redirect
+	}
+	cmd.Stderr = c.pipes[StreamStderr][1]
+	return nil
+}
+
+// attachTerminal connects cmd to the terminal and reads its output from
+// the master side, reported as stdout
+func (c *outputCollector) attachTerminal(cmd *exec.Cmd, term *terminal) error {
+	if err := c.openSpill(); err != nil {
+		return err
+	}
+	term.attach(cmd)
+	c.pipes[StreamStdout] = [2]*os.File{term.master, term.slave}
+	return nil
+}
+
+// openSpill creates the spill file if one was requested
+func (c *outputCollector) openSpill() error {
+	if c.spillDir == "" {
+		return nil
+	}
+	spill, err := newSpillFile(c.spillDir, c.command)
+	if err != nil {
+		return err
+	}
+	c.spill = spill
+	return nil
+}
+
+// start closes the parent's write ends and begins copying; it must be
+// called after cmd.Start, whether or not the start succeeded
+func (c *outputCollector) start() {
+	c.mu.Lock()
+	c.lastRead = time.Now()
+	c.mu.Unlock()
+
+	if c.redirect != nil {
+		c.redirect.Close()
+	}
+	for stream, pipe := range c.pipes {
+		pipe[1].Close()
+		c.copying.Add(1)
+		go c.copy(stream, pipe[0])
+	}
+}
+
+// copy reads a stream until EOF or until its pipe is closed
+func (c *outputCollector) copy(stream string, r *os.File) {
+	defer c.copying.Done()
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			c.write(stream, buf[:n])
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// wait waits until both streams reached EOF. After timeout the pipes are
+// closed, abandoning output of processes that still hold them open.
+func (c *outputCollector) wait(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		c.copying.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		c.closePipes()
+		<-done
+	}
+	c.closePipes()
+	c.flush()
+	if c.expecter != nil {
+		c.expecter.finish()
+	}
+
+	if c.spill != nil {
+		c.spillErr = c.spill.Close()
+	}
+}
+
+// closePipes closes every pipe end held by the collector
+func (c *outputCollector) closePipes() {
+	for _, pipe := range c.pipes {
+		pipe[0].Close()
+		pipe[1].Close()
+	}
+}
+
+// write records p and forwards it
+func (c *outputCollector) write(stream string, p []byte) {
+	c.record(OutputChunk{Stream: stream, Data: append([]byte(nil), p...), Time: time.Now()})
+	c.deliver()
+}
+
+// record stores chunk and queues it for the writer and callback
+func (c *outputCollector) record(chunk OutputChunk) {
+	stream := chunk.Stream
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lastRead = chunk.Time
+	c.combined.Write(chunk.Data)
+	if stream == StreamStdout {
+		c.stdout.Write(chunk.Data)
+	} else {
+		c.stderr.Write(chunk.Data)
+	}
+	if c.spill != nil {
+		c.spill.Write(chunk.Data)
+	}
+	if c.expecter != nil {
+		c.expecter.feed(chunk.Data)
+	}
+	if c.chunkCap <= 0 || c.chunkLen+len(chunk.Data) <= c.chunkCap {
+		c.chunks = append(c.chunks, chunk)
+		c.chunkLen += len(chunk.Data)
+	} else {
+		c.dropped = true
+	}
+
+	out := pendingOutput{writer: c.writers[stream], data: chunk.Data}
+	switch {
+	case c.onOutput == nil:
+	case !c.lines:
+		out.chunks = []OutputChunk{chunk}
+	default:
+		// Line mode: deliver every complete line, keep the remainder
+		buf := append(c.partial[stream], chunk.Data...)
+		for {
+			i := bytes.IndexByte(buf, '\n')
+			if i < 0 {
+				break
+			}
+			out.chunks = append(out.chunks, OutputChunk{Stream: stream, Data: append([]byte(nil), buf[:i+1]...), Time: chunk.Time})
+			buf = buf[i+1:]
+		}
+		c.partial[stream] = buf
+	}
+	if out.writer != nil || len(out.chunks) > 0 {
+		c.pending = append(c.pending, out)
+	}
+}
+
+// deliver forwards the queued output in the order it was recorded. The
+// writers and the callback run without mu held, so a slow consumer does not
+// block recording and a callback may read the output collected so far.
+// Errors of user supplied writers are ignored so a broken sink cannot kill
+// the command with SIGPIPE.
+func (c *outputCollector) deliver() {
+	c.delivery.Lock()
+	defer c.delivery.Unlock()
+
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = nil
+	c.mu.Unlock()
+
+	for _, out := range pending {
+		if out.writer != nil {
+			out.writer.Write(out.data)
+		}
+		for _, chunk := range out.chunks {
+			c.onOutput(chunk)
+		}
+	}
+}
+
+// lastActivity returns when the command last produced output, or when it
+// started if it has not produced any
+func (c *outputCollector) lastActivity() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastRead
+}
+
+// flush delivers incomplete trailing lines once the command has finished
+func (c *outputCollector) flush() {
+	if c.onOutput == nil {
+		return
+	}
+
+	c.mu.Lock()
+	for _, stream := range []string{StreamStdout, StreamStderr} {
+		if rest := c.partial[stream]; len(rest) > 0 {
+			chunk := OutputChunk{Stream: stream, Data: rest, Time: time.Now()}
+			c.pending = append(c.pending, pendingOutput{chunks: []OutputChunk{chunk}})
+			c.partial[stream] = nil
+		}
+	}
+	c.mu.Unlock()
+	c.deliver()
+}
+
+// fill copies the collected output into result
+func (c *outputCollector) fill(result *CommandResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result.Output = c.combined.Bytes()
+	result.Stdout = c.stdout.Bytes()
+	result.Stderr = c.stderr.Bytes()
+	result.Chunks = append([]OutputChunk(nil), c.chunks...)
+	result.OutputBytes = c.combined.total
+	result.Truncated = c.dropped || c.combined.Truncated() || c.stdout.Truncated() || c.stderr.Truncated()
+	if c.spill != nil {
+		result.OutputFile = c.spill.path
+	}
+}
+
+// snapshot returns a copy of the output collected so far for stream, or the
+// combined output when stream is empty
+func (c *outputCollector) snapshot(stream string) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch stream {
+	case StreamStdout:
+		return c.stdout.Bytes()
+	case StreamStderr:
+		return c.stderr.Bytes()
+	default:
+		return c.combined.Bytes()
+	}
+}
@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestOutputCollectorLines tests line splitting across chunk boundaries
+func TestOutputCollectorLines(t *testing.T) {
+	var got []string
+	c := newOutputCollector(CommandConfig{LineBuffered: true}, func(chunk OutputChunk) {
+		got = append(got, chunk.Stream+":"+string(chunk.Data))
+	})
+
+	c.write(StreamStdout, []byte("par"))
+	c.write(StreamStderr, []byte("e1\ne"))
+	c.write(StreamStdout, []byte("tial\nnext\n"))
+	c.write(StreamStderr, []byte("2"))
+	c.flush()
+
+	want := []string{"stderr:e1\n", "stdout:partial\n", "stdout:next\n", "stderr:e2"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Lines = %q, want %q", got, want)
+	}
+
+	var result CommandResult
+	c.fill(&result)
+	if string(result.Stdout) != "partial\nnext\n" || string(result.Stderr) != "e1\ne2" {
+		t.Errorf("Streams mismatch. Stdout: %q, Stderr: %q", result.Stdout, result.Stderr)
+	}
+	if string(result.Output) != "pare1\netial\nnext\n2" {
+		t.Errorf("Combined output = %q", result.Output)
+	}
+	if len(result.Chunks) != 4 {
+		t.Errorf("Expected 4 chunks, got %d", len(result.Chunks))
+	}
+}
+
+// TestOutputCollectorChunks tests raw chunk delivery without line mode
+func TestOutputCollectorChunks(t *testing.T) {
+	var got []string
+	c := newOutputCollector(CommandConfig{}, func(chunk OutputChunk) {
+		got = append(got, string(chunk.Data))
+	})
+
+	c.write(StreamStdout, []byte("a"))
+	c.write(StreamStdout, []byte("b\nc"))
+	c.flush()
+
+	if strings.Join(got, "|") != "a|b\nc" {
+		t.Errorf("Chunks = %q", got)
+	}
+}
+
+// TestOutputCollectorSlowCallback tests that callbacks may read the output
+// and that a blocked callback does not stop the other stream from being
+// recorded
+func TestOutputCollectorSlowCallback(t *testing.T) {
+	release := make(chan struct{})
+	var c *outputCollector
+	var missing []string
+	c = newOutputCollector(CommandConfig{}, func(chunk OutputChunk) {
+		if !strings.Contains(string(c.snapshot("")), string(chunk.Data)) {
+			missing = append(missing, string(chunk.Data))
+		}
+		if chunk.Stream == StreamStdout {
+			<-release
+		}
+	})
+
+	var writing sync.WaitGroup
+	writing.Add(2)
+	go func() {
+		defer writing.Done()
+		c.write(StreamStdout, []byte("out\n"))
+	}()
+	go func() {
+		defer writing.Done()
+		c.write(StreamStderr, []byte("err\n"))
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for string(c.snapshot(StreamStderr)) != "err\n" {
+		if time.Now().After(deadline) {
+			t.Fatal("Stderr was not recorded while the stdout callback was blocked")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(release)
+
+	done := make(chan struct{})
+	go func() {
+		writing.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Callbacks did not return")
+	}
+	if len(missing) > 0 {
+		t.Errorf("Snapshots in callbacks lack %q", missing)
+	}
+}
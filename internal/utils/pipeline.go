@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// PipelineConfig holds the configuration of a command pipeline
+type PipelineConfig struct {
+	Stages   []CommandConfig // Commands in order; each stage's stdout is the next stage's stdin
+	Timeout  time.Duration   // Timeout of the whole pipeline; stages may set their own (optional)
+	Pipefail bool            // Fail when any stage fails instead of only when the last stage fails
+}
+
+// PipelineResult holds the result of a pipeline execution
+type PipelineResult struct {
+	Command    string           `json:"command"`    // The stages joined by " | "
+	Stages     []*CommandResult `json:"stages"`     // Result of every stage; Stdout is empty for all but the last
+	Output     []byte           `json:"output"`     // Standard output of the last stage
+	Successful bool             `json:"successful"` // Whether the pipeline succeeded according to Pipefail
+	TimedOut   bool             `json:"timed_out"`  // Whether the pipeline or a stage timed out
+	Canceled   bool             `json:"canceled"`   // Whether the pipeline was canceled
+	Duration   time.Duration    `json:"duration"`   // Wall clock duration of the whole pipeline
+}
+
+// ExecutePipeline runs commands connected like a shell pipeline, without a
+// shell. All stages run concurrently, each in its own process group. The
+// standard output of every stage but the last goes to the next stage only,
+// so their OnOutput, MaxOutputBytes and SpillDir see standard error alone.
+func ExecutePipeline(config PipelineConfig) (*PipelineResult, error) {
+	return ExecutePipelineContext(context.Background(), config)
+}
+
+// ExecutePipelineContext runs a pipeline; cancelling ctx terminates every stage
+func ExecutePipelineContext(ctx context.Context, config PipelineConfig) (*PipelineResult, error) {
+	if err := validatePipeline(config); err != nil {
+		return nil, err
+	}
+
+	// Create context with timeout
+	var cancel context.CancelFunc
+	if config.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, config.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	// Connect neighbouring stages
+	n := len(config.Stages)
+	readers := make([]*os.File, n)
+	writers := make([]*os.File, n)
+	closePipes := func() {
+		for i := range n {
+			if readers[i] != nil {
+				readers[i].Close()
+			}
+			if writers[i] != nil {
+				writers[i].Close()
+			}
+		}
+	}
+	for i := 0; i < n-1; i++ {
+		r, w, err := os.Pipe()
+		if err != nil {
+			closePipes()
+			return nil, fmt.Errorf("failed to create pipe: %w", err)
+		}
+		writers[i], readers[i+1] = w, r
+	}
+
+	start := time.Now()
+	handles := make([]*CommandHandle, 0, n)
+	var startErr error
+	for i, stage := range config.Stages {
+		stage.stdoutPipe = writers[i]
+		stage.stdinPipe = readers[i]
+		h, err := startCommand(ctx, stage, stage.OnOutput)
+		if err != nil {
+			startErr = fmt.Errorf("pipeline stage %d: %w", i+1, err)
+			break
+		}
+		handles = append(handles, h)
+	}
+
+	// The stages hold their own copies of the pipe ends now
+	closePipes()
+	if startErr != nil {
+		cancel()
+		for _, h := range handles {
+			h.Wait()
+		}
+		return nil, startErr
+	}
+
+	result := &PipelineResult{Command: describePipeline(config)}
+	var lastErr, failErr error
+	for i, h := range handles {
+		stageResult, err := h.Wait()
+		result.Stages = append(result.Stages, stageResult)
+		result.TimedOut = result.TimedOut || stageResult.TimedOut
+		if err != nil {
+			lastErr = fmt.Errorf("pipeline stage %d failed: %w", i+1, err)
+			if i == n-1 || config.Pipefail {
+				failErr = lastErr
+			}
+		}
+	}
+	result.Duration = time.Since(start)
+	result.Output = result.Stages[n-1].Stdout
+
+	// Check for timeout and cancellation of the whole pipeline
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded) && config.Timeout > 0:
+		result.TimedOut = true
+		return result, fmt.Errorf("pipeline timed out after %v", config.Timeout)
+	case errors.Is(ctx.Err(), context.Canceled) && failErr != nil:
+		result.Canceled = true
+		return result, fmt.Errorf("pipeline canceled: %w", context.Canceled)
+	}
+
+	result.Successful = failErr == nil
+	return result, failErr
+}
+
+// validatePipeline rejects stage options that conflict with the pipes
+func validatePipeline(config PipelineConfig) error {
+	if len(config.Stages) == 0 {
+		return errors.New("pipeline has no stages")
+	}
+	for i, stage := range config.Stages {
+		if i > 0 && (stage.StdinData != nil || stage.StdinFile != "" || stage.Stdin != nil) {
+			return fmt.Errorf("pipeline stage %d: stdin is the output of the previous stage", i+1)
+		}
+		if stage.PTY != nil {
+			return fmt.Errorf("pipeline stage %d: stages cannot run on a pseudo-terminal", i+1)
+		}
+		if stage.Retry.MaxAttempts > 1 {
+			return fmt.Errorf("pipeline stage %d: stages cannot be retried", i+1)
+		}
+		if i == len(config.Stages)-1 {
+			continue
+		}
+		if stage.IdleTimeout > 0 {
+			return fmt.Errorf("pipeline stage %d: only the last stage can have an idle timeout, the output of the others is not observed", i+1)
+		}
+		if stage.Stdout != nil {
+			return fmt.Errorf("pipeline stage %d: stdout is the input of the next stage", i+1)
+		}
+		if p, ok := stdoutPattern(stage.Success); ok {
+			return fmt.Errorf("pipeline stage %d: pattern %q cannot match stdout, it is the input of the next stage", i+1, p.Pattern)
+		}
+	}
+	return nil
+}
+
+// stdoutPattern returns the first output pattern of rules restricted to stdout
+func stdoutPattern(rules SuccessRules) (OutputPattern, bool) {
+	for _, p := range slices.Concat(rules.SuccessPatterns, rules.FailurePatterns) {
+		if p.Stream == StreamStdout {
+			return p, true
+		}
+	}
+	return OutputPattern{}, false
+}
+
+// describePipeline returns the command line reported in PipelineResult
+func describePipeline(config PipelineConfig) string {
+	commands := make([]string, len(config.Stages))
+	for i, stage := range config.Stages {
+		commands[i] = strings.TrimSpace(describeCommand(stage))
+	}
+	return strings.Join(commands, " | ")
+}
@@ -0,0 +1,144 @@
+package utils
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestExecutePipeline tests data flow and per-stage results
+func TestExecutePipeline(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	result, err := ExecutePipeline(PipelineConfig{
+		Stages: []CommandConfig{
+			{Command: "sh", Args: []string{"-c", "printf 'b\\na\\nc\\n'; echo warn >&2"}},
+			{Command: "sort"},
+			{Command: "head", Args: []string{"-n", "2"}},
+		},
+	})
+	if err != nil || !result.Successful {
+		t.Fatalf("ExecutePipeline() error = %v", err)
+	}
+	if string(result.Output) != "a\nb\n" {
+		t.Errorf("Output = %q, want %q", result.Output, "a\nb\n")
+	}
+	if len(result.Stages) != 3 {
+		t.Fatalf("len(Stages) = %d, want 3", len(result.Stages))
+	}
+	if len(result.Stages[0].Stdout) != 0 || string(result.Stages[0].Stderr) != "warn\n" {
+		t.Errorf("Stage 1 Stdout = %q, Stderr = %q, want only stderr", result.Stages[0].Stdout, result.Stages[0].Stderr)
+	}
+	for i, stage := range result.Stages {
+		if stage.ExitCode != 0 {
+			t.Errorf("Stage %d ExitCode = %d, want 0", i+1, stage.ExitCode)
+		}
+	}
+	if result.Command != "sh -c printf 'b\\na\\nc\\n'; echo warn >&2 | sort | head -n 2" {
+		t.Errorf("Command = %q", result.Command)
+	}
+}
+
+// TestExecutePipelinePipefail tests which stage failures fail the pipeline
+func TestExecutePipelinePipefail(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	tests := []struct {
+		name        string
+		stages      []CommandConfig
+		pipefail    bool
+		wantSuccess bool
+		wantErr     string
+	}{
+		{
+			name:        "Early failure ignored",
+			stages:      []CommandConfig{{Command: "sh", Args: []string{"-c", "echo x; exit 3"}}, {Command: "cat"}},
+			wantSuccess: true,
+		},
+		{
+			name:        "Early failure with pipefail",
+			stages:      []CommandConfig{{Command: "sh", Args: []string{"-c", "echo x; exit 3"}}, {Command: "cat"}},
+			pipefail:    true,
+			wantSuccess: false,
+			wantErr:     "pipeline stage 1 failed",
+		},
+		{
+			name:        "Last stage failure",
+			stages:      []CommandConfig{{Command: "echo", Args: []string{"x"}}, {Command: "false"}},
+			wantSuccess: false,
+			wantErr:     "pipeline stage 2 failed",
+		},
+		{
+			name:        "Consumer exits early",
+			stages:      []CommandConfig{{Command: "yes"}, {Command: "head", Args: []string{"-n", "1"}}},
+			wantSuccess: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ExecutePipeline(PipelineConfig{Stages: tt.stages, Pipefail: tt.pipefail})
+			if result.Successful != tt.wantSuccess {
+				t.Errorf("Successful = %v, want %v (error %v)", result.Successful, tt.wantSuccess, err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("ExecutePipeline() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestExecutePipelineTimeout tests the shared timeout and cancellation
+func TestExecutePipelineTimeout(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+	stages := []CommandConfig{
+		{Command: "sleep", Args: []string{"5"}, GracePeriod: 100 * time.Millisecond},
+		{Command: "cat", GracePeriod: 100 * time.Millisecond},
+	}
+
+	start := time.Now()
+	result, err := ExecutePipeline(PipelineConfig{Stages: stages, Timeout: 200 * time.Millisecond})
+	if err == nil || !result.TimedOut || result.Successful {
+		t.Errorf("ExecutePipeline() error = %v, TimedOut = %v, want timeout", err, result.TimedOut)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Timeout took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	result, err = ExecutePipelineContext(ctx, PipelineConfig{Stages: stages})
+	if err == nil || !result.Canceled {
+		t.Errorf("ExecutePipelineContext() error = %v, Canceled = %v, want cancellation", err, result.Canceled)
+	}
+}
+
+// TestExecutePipelineInvalid tests rejected pipeline configurations
+func TestExecutePipelineInvalid(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	tests := []struct {
+		name    string
+		config  PipelineConfig
+		wantErr string
+	}{
+		{"No stages", PipelineConfig{}, "no stages"},
+		{"Stdin of later stage", PipelineConfig{Stages: []CommandConfig{{Command: "echo"}, {Command: "cat", StdinData: []byte("x")}}}, "stage 2: stdin"},
+		{"Retried stage", PipelineConfig{Stages: []CommandConfig{{Command: "echo", Retry: RetryPolicy{MaxAttempts: 2}}}}, "cannot be retried"},
+		{"Idle timeout of earlier stage", PipelineConfig{Stages: []CommandConfig{{Command: "yes", IdleTimeout: time.Second}, {Command: "head"}}}, "stage 1: only the last stage"},
+		{"Stdout writer of earlier stage", PipelineConfig{Stages: []CommandConfig{{Command: "echo", Stdout: io.Discard}, {Command: "cat"}}}, "stage 1: stdout is the input"},
+		{"Stdout pattern of earlier stage", PipelineConfig{Stages: []CommandConfig{{Command: "echo", Success: SuccessRules{FailurePatterns: []OutputPattern{{Stream: StreamStdout, Pattern: `ERROR`}}}}, {Command: "cat"}}}, `stage 1: pattern "ERROR" cannot match stdout`},
+		{"Invalid stage", PipelineConfig{Stages: []CommandConfig{{Command: "echo"}, {Script: "x", Interpreter: "ruby"}}}, "pipeline stage 2: unsupported"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ExecutePipeline(tt.config)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ExecutePipeline() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,325 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// ErrPoolClosed is returned for tasks submitted to or dropped by a pool that
+// was shut down
+var ErrPoolClosed = errors.New("executor pool closed")
+
+// PoolConfig holds the configuration of an executor pool
+type PoolConfig struct {
+	Workers         int             // Max commands running at once (default: number of CPUs)
+	QueueSize       int             // Max tasks waiting for a worker; Submit blocks when full (default: 100)
+	KeyLimits       map[string]int  // Max commands running at once per task key (optional)
+	DefaultKeyLimit int             // Limit for keys missing from KeyLimits, 0 for none
+	OnProgress      func(PoolStats) // Called after every finished task (optional)
+	OnComplete      func(*PoolTask) // Called with every finished task (optional)
+}
+
+// PoolStats is a snapshot of the progress of a pool
+type PoolStats struct {
+	Submitted int `json:"submitted"` // Tasks accepted by Submit
+	Queued    int `json:"queued"`    // Tasks waiting for a worker
+	Running   int `json:"running"`   // Tasks executing
+	Completed int `json:"completed"` // Tasks finished, whatever their outcome
+	Succeeded int `json:"succeeded"` // Finished tasks whose command succeeded
+	Failed    int `json:"failed"`    // Finished tasks whose command failed or could not start
+	Canceled  int `json:"canceled"`  // Tasks whose context ended or that were dropped on shutdown
+}
+
+// PoolTask is a command submitted to a pool
+type PoolTask struct {
+	Key    string        // Key the per-key limits apply to
+	Config CommandConfig // Command to execute
+
+	ctx       context.Context
+	stopWatch func() bool // Stops watching ctx while queued
+	queued    bool        // Whether the task waits in the queue
+	done      chan struct{}
+	result    *CommandResult
+	err       error
+}
+
+// Wait blocks until the task has finished and returns its result; the
+// result is nil if the command never ran
+func (t *PoolTask) Wait() (*CommandResult, error) {
+	<-t.done
+	return t.result, t.err
+}
+
+// Done returns a channel that is closed when the task has finished
+func (t *PoolTask) Done() <-chan struct{} {
+	return t.done
+}
+
+// Pool executes commands with bounded concurrency. Tasks start in
+// submission order, except that a task whose key is at its limit lets
+// tasks with other keys pass.
+type Pool struct {
+	config PoolConfig
+	ctx    context.Context    // Canceled to abort running tasks on shutdown
+	cancel context.CancelFunc // Cancels ctx
+	slots  chan struct{}      // One entry per queued task
+
+	mu         sync.Mutex
+	queue      []*PoolTask
+	keyRunning map[string]int
+	stats      PoolStats
+	finishing  int // Finished tasks whose callbacks are still running
+	closed     bool
+	closing    chan struct{} // Closed once Shutdown was called
+	idle       *sync.Cond    // Signalled when a task finishes
+}
+
+// NewPool creates an executor pool
+func NewPool(config PoolConfig) *Pool {
+	// Set defaults if not specified
+	if config.Workers <= 0 {
+		config.Workers = runtime.NumCPU()
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 100
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool{
+		config:     config,
+		ctx:        ctx,
+		cancel:     cancel,
+		slots:      make(chan struct{}, config.QueueSize),
+		keyRunning: make(map[string]int),
+		closing:    make(chan struct{}),
+	}
+	p.idle = sync.NewCond(&p.mu)
+	return p
+}
+
+// Submit queues a command for execution. It blocks while the queue is full
+// and fails when ctx ends first or the pool was shut down. ctx also bounds
+// the execution: ending it removes a queued task or terminates the command.
+func (p *Pool) Submit(ctx context.Context, key string, config CommandConfig) (*PoolTask, error) {
+	select {
+	case <-p.closing:
+		return nil, ErrPoolClosed
+	default:
+	}
+
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-p.closing:
+		return nil, ErrPoolClosed
+	}
+
+	task := &PoolTask{Key: key, Config: config, ctx: ctx, queued: true, done: make(chan struct{})}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		<-p.slots
+		return nil, ErrPoolClosed
+	}
+	p.queue = append(p.queue, task)
+	p.stats.Submitted++
+	p.stats.Queued++
+
+	// Drop the task from the queue when its context ends first
+	task.stopWatch = context.AfterFunc(ctx, func() {
+		p.mu.Lock()
+		removed := p.dequeue(task)
+		if removed {
+			p.stats.Canceled++
+			p.stats.Completed++
+			p.finishing++
+		}
+		p.mu.Unlock()
+		if removed {
+			p.finish(task, nil, ctx.Err())
+		}
+	})
+	p.dispatch()
+	p.mu.Unlock()
+	return task, nil
+}
+
+// ExecuteAll runs every config under key and waits for all of them. Results
+// are in the order of configs; the error joins the errors of all tasks.
+func (p *Pool) ExecuteAll(ctx context.Context, key string, configs []CommandConfig) ([]*CommandResult, error) {
+	tasks := make([]*PoolTask, len(configs))
+	errs := make([]error, len(configs))
+	for i, config := range configs {
+		tasks[i], errs[i] = p.Submit(ctx, key, config)
+	}
+
+	results := make([]*CommandResult, len(configs))
+	for i, task := range tasks {
+		if task != nil {
+			results[i], errs[i] = task.Wait()
+		}
+		if errs[i] != nil {
+			errs[i] = fmt.Errorf("task %d: %w", i+1, errs[i])
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// Stats returns the current progress of the pool
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats
+}
+
+// Wait blocks until no task is queued or running and the callbacks of
+// finished tasks have returned
+func (p *Pool) Wait() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.stats.Queued > 0 || p.stats.Running > 0 || p.finishing > 0 {
+		p.idle.Wait()
+	}
+}
+
+// Shutdown stops accepting tasks and waits for queued and running tasks to
+// finish. When ctx ends first, queued tasks are dropped with ErrPoolClosed,
+// running commands are terminated, and ctx's error is returned once they
+// have exited.
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.closing)
+	}
+	p.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		p.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+	}
+
+	// Abort: drop the queue and terminate running commands
+	p.mu.Lock()
+	dropped := append([]*PoolTask(nil), p.queue...)
+	for _, task := range dropped {
+		p.dequeue(task)
+		p.stats.Canceled++
+		p.stats.Completed++
+		p.finishing++
+	}
+	p.mu.Unlock()
+	for _, task := range dropped {
+		p.finish(task, nil, ErrPoolClosed)
+	}
+
+	p.cancel()
+	<-drained
+	return ctx.Err()
+}
+
+// dispatch starts queued tasks while workers and key limits allow; the
+// caller holds mu
+func (p *Pool) dispatch() {
+	for i := 0; i < len(p.queue) && p.stats.Running < p.config.Workers; {
+		task := p.queue[i]
+		if !p.keyAvailable(task.Key) {
+			i++
+			continue
+		}
+		p.dequeue(task)
+		p.stats.Running++
+		p.keyRunning[task.Key]++
+		go p.run(task)
+	}
+}
+
+// keyAvailable reports whether another task with key may start; the caller
+// holds mu
+func (p *Pool) keyAvailable(key string) bool {
+	limit, ok := p.config.KeyLimits[key]
+	if !ok {
+		limit = p.config.DefaultKeyLimit
+	}
+	return limit <= 0 || p.keyRunning[key] < limit
+}
+
+// dequeue removes a queued task and frees its slot, reporting whether it
+// was still queued; the caller holds mu
+func (p *Pool) dequeue(task *PoolTask) bool {
+	if !task.queued {
+		return false
+	}
+	for i, t := range p.queue {
+		if t == task {
+			p.queue = append(p.queue[:i], p.queue[i+1:]...)
+			break
+		}
+	}
+	task.queued = false
+	p.stats.Queued--
+	<-p.slots
+	return true
+}
+
+// run executes a task and starts the next ones
+func (p *Pool) run(task *PoolTask) {
+	ctx, cancel := context.WithCancel(task.ctx)
+	stop := context.AfterFunc(p.ctx, cancel)
+	result, err := ExecuteCommandContext(ctx, task.Config)
+	stop()
+	cancel()
+
+	p.mu.Lock()
+	p.stats.Running--
+	p.stats.Completed++
+	p.keyRunning[task.Key]--
+	if p.keyRunning[task.Key] == 0 {
+		delete(p.keyRunning, task.Key)
+	}
+	switch {
+	case err == nil:
+		p.stats.Succeeded++
+	case task.ctx.Err() != nil || p.ctx.Err() != nil:
+		p.stats.Canceled++
+	default:
+		p.stats.Failed++
+	}
+	p.finishing++
+	p.dispatch()
+	p.mu.Unlock()
+
+	p.finish(task, result, err)
+}
+
+// finish publishes the outcome of a task and reports progress; the caller
+// counted the task in finishing
+func (p *Pool) finish(task *PoolTask, result *CommandResult, err error) {
+	task.stopWatch()
+	task.result, task.err = result, err
+	close(task.done)
+
+	if p.config.OnComplete != nil {
+		p.config.OnComplete(task)
+	}
+	if p.config.OnProgress != nil {
+		p.config.OnProgress(p.Stats())
+	}
+
+	p.mu.Lock()
+	p.finishing--
+	p.idle.Broadcast()
+	p.mu.Unlock()
+}
@@ -0,0 +1,283 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// concurrencyTracker records the highest number of tasks running at once
+// through the pool's progress and completion callbacks
+type concurrencyTracker struct {
+	mu      sync.Mutex
+	maxRun  int
+	updates []PoolStats
+}
+
+func (c *concurrencyTracker) observe(pool *Pool) {
+	stats := pool.Stats()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if stats.Running > c.maxRun {
+		c.maxRun = stats.Running
+	}
+}
+
+// TestPoolConcurrencyLimit tests that no more than Workers commands run at once
+func TestPoolConcurrencyLimit(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	tracker := &concurrencyTracker{}
+	pool := NewPool(PoolConfig{
+		Workers: 2,
+		OnProgress: func(stats PoolStats) {
+			tracker.mu.Lock()
+			tracker.updates = append(tracker.updates, stats)
+			tracker.mu.Unlock()
+		},
+	})
+
+	var tasks []*PoolTask
+	for range 6 {
+		task, err := pool.Submit(context.Background(), "", CommandConfig{Command: "sleep", Args: []string{"0.1"}})
+		if err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+		tasks = append(tasks, task)
+		tracker.observe(pool)
+	}
+	for range 5 {
+		time.Sleep(50 * time.Millisecond)
+		tracker.observe(pool)
+	}
+	for _, task := range tasks {
+		if _, err := task.Wait(); err != nil {
+			t.Errorf("Wait() error = %v", err)
+		}
+	}
+	pool.Wait()
+
+	if tracker.maxRun > 2 {
+		t.Errorf("max Running = %d, want at most 2", tracker.maxRun)
+	}
+	want := PoolStats{Submitted: 6, Completed: 6, Succeeded: 6}
+	if stats := pool.Stats(); stats != want {
+		t.Errorf("Stats() = %+v, want %+v", stats, want)
+	}
+	if len(tracker.updates) != 6 {
+		t.Errorf("OnProgress called %d times, want 6", len(tracker.updates))
+	}
+}
+
+// TestPoolKeyLimits tests that a key at its limit waits while other keys pass
+func TestPoolKeyLimits(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	var mu sync.Mutex
+	var order []string
+	pool := NewPool(PoolConfig{
+		Workers:   4,
+		KeyLimits: map[string]int{"slow": 1},
+		OnComplete: func(task *PoolTask) {
+			mu.Lock()
+			order = append(order, task.Key)
+			mu.Unlock()
+		},
+	})
+
+	slow := CommandConfig{Command: "sleep", Args: []string{"0.3"}}
+	for _, key := range []string{"slow", "slow", "fast"} {
+		config := slow
+		if key == "fast" {
+			config = CommandConfig{Command: "true"}
+		}
+		if _, err := pool.Submit(context.Background(), key, config); err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if stats := pool.Stats(); stats.Running != 1 || stats.Queued != 1 {
+		t.Errorf("Stats() = %+v, want 1 slow task running and 1 queued", stats)
+	}
+
+	start := time.Now()
+	pool.Wait()
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("slow tasks finished after %v, want them serialized", elapsed)
+	}
+	if strings.Join(order, ",") != "fast,slow,slow" {
+		t.Errorf("completion order = %v, want fast before slow tasks", order)
+	}
+}
+
+// TestPoolSubmitQueueFull tests that Submit blocks on a full queue until its
+// context ends
+func TestPoolSubmitQueueFull(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	pool := NewPool(PoolConfig{Workers: 1, QueueSize: 1})
+	defer pool.Shutdown(context.Background())
+
+	long := CommandConfig{Command: "sleep", Args: []string{"0.5"}}
+	if _, err := pool.Submit(context.Background(), "", long); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if _, err := pool.Submit(context.Background(), "", long); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := pool.Submit(ctx, "", long)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Submit() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Submit() returned after %v, want it to block", elapsed)
+	}
+	if stats := pool.Stats(); stats.Submitted != 2 {
+		t.Errorf("Submitted = %d, want 2", stats.Submitted)
+	}
+}
+
+// TestPoolTaskCanceled tests that ending a task's context removes it from
+// the queue or terminates its command
+func TestPoolTaskCanceled(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	pool := NewPool(PoolConfig{Workers: 1})
+	config := CommandConfig{Command: "sleep", Args: []string{"5"}, GracePeriod: 100 * time.Millisecond}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	running, err := pool.Submit(ctx, "", config)
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	queued, err := pool.Submit(ctx, "", config)
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	cancel()
+
+	result, err := queued.Wait()
+	if result != nil || !errors.Is(err, context.Canceled) {
+		t.Errorf("queued task Wait() = %v, %v, want nil result and %v", result, err, context.Canceled)
+	}
+	result, err = running.Wait()
+	if err == nil || result == nil || !result.Canceled {
+		t.Errorf("running task Wait() error = %v, want canceled command", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("cancellation took %v", elapsed)
+	}
+
+	pool.Wait()
+	want := PoolStats{Submitted: 2, Completed: 2, Canceled: 2}
+	if stats := pool.Stats(); stats != want {
+		t.Errorf("Stats() = %+v, want %+v", stats, want)
+	}
+}
+
+// TestPoolExecuteAll tests result order and the aggregated error
+func TestPoolExecuteAll(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	pool := NewPool(PoolConfig{Workers: 3})
+	results, err := pool.ExecuteAll(context.Background(), "batch", []CommandConfig{
+		{Command: "sh", Args: []string{"-c", "sleep 0.2; echo first"}},
+		{Command: "sh", Args: []string{"-c", "exit 4"}},
+		{Command: "echo", Args: []string{"third"}},
+	})
+
+	if len(results) != 3 {
+		t.Fatalf("len(results) = %d, want 3", len(results))
+	}
+	if string(results[0].Output) != "first\n" || string(results[2].Output) != "third\n" {
+		t.Errorf("Output = %q, %q, want results in submission order", results[0].Output, results[2].Output)
+	}
+	if results[1].ExitCode != 4 || results[1].Successful {
+		t.Errorf("results[1] ExitCode = %d, Successful = %v, want failure with 4", results[1].ExitCode, results[1].Successful)
+	}
+	if err == nil || !strings.Contains(err.Error(), "task 2:") || strings.Contains(err.Error(), "task 1:") {
+		t.Errorf("ExecuteAll() error = %v, want only task 2 failing", err)
+	}
+
+	want := PoolStats{Submitted: 3, Completed: 3, Succeeded: 2, Failed: 1}
+	if stats := pool.Stats(); stats != want {
+		t.Errorf("Stats() = %+v, want %+v", stats, want)
+	}
+}
+
+// TestPoolShutdown tests draining and aborting shutdowns
+func TestPoolShutdown(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	t.Run("Drain", func(t *testing.T) {
+		pool := NewPool(PoolConfig{Workers: 1})
+		var tasks []*PoolTask
+		for range 3 {
+			task, err := pool.Submit(context.Background(), "", CommandConfig{Command: "sleep", Args: []string{"0.05"}})
+			if err != nil {
+				t.Fatalf("Submit() error = %v", err)
+			}
+			tasks = append(tasks, task)
+		}
+
+		if err := pool.Shutdown(context.Background()); err != nil {
+			t.Errorf("Shutdown() error = %v", err)
+		}
+		for _, task := range tasks {
+			select {
+			case <-task.Done():
+			default:
+				t.Errorf("task not finished after Shutdown()")
+			}
+		}
+		if _, err := pool.Submit(context.Background(), "", CommandConfig{Command: "true"}); !errors.Is(err, ErrPoolClosed) {
+			t.Errorf("Submit() after Shutdown() error = %v, want %v", err, ErrPoolClosed)
+		}
+	})
+
+	t.Run("Abort", func(t *testing.T) {
+		pool := NewPool(PoolConfig{Workers: 1})
+		config := CommandConfig{Command: "sleep", Args: []string{"5"}, GracePeriod: 100 * time.Millisecond}
+		running, err := pool.Submit(context.Background(), "", config)
+		if err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+		queued, err := pool.Submit(context.Background(), "", config)
+		if err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		if err := pool.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Shutdown() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("Shutdown() took %v", elapsed)
+		}
+
+		if _, err := queued.Wait(); !errors.Is(err, ErrPoolClosed) {
+			t.Errorf("queued task Wait() error = %v, want %v", err, ErrPoolClosed)
+		}
+		if result, err := running.Wait(); err == nil || !result.Canceled {
+			t.Errorf("running task Wait() error = %v, want canceled command", err)
+		}
+		want := PoolStats{Submitted: 2, Completed: 2, Canceled: 2}
+		if stats := pool.Stats(); stats != want {
+			t.Errorf("Stats() = %+v, want %+v", stats, want)
+		}
+	})
+}
@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Defaults for pseudo-terminal execution
+const (
+	defaultPTYRows       = 24
+	defaultPTYCols       = 80
+	defaultExpectTimeout = 10 * time.Second
+	maxExpectBuffer      = 64 * 1024 // Output kept for matching the next step
+)
+
+// PTYConfig runs a command on a pseudo-terminal. Standard input, output and
+// error of the command are the terminal, so all output is reported as
+// stdout and the stdin options cannot be used.
+type PTYConfig struct {
+	Rows   uint16       // Window height (default: 24)
+	Cols   uint16       // Window width (default: 80)
+	Expect []ExpectStep // Scripted interaction, run in order (optional)
+}
+
+// ExpectStep waits for output matching a pattern and answers it
+type ExpectStep struct {
+	Expect  string        // Regular expression matched against the output since the previous step
+	Send    string        // Written to the terminal once Expect matched, e.g. "yes\n" (optional)
+	Timeout time.Duration // Max time to wait for Expect; the command is terminated on expiry (default: 10s)
+}
+
+// terminal is the pseudo-terminal of a command
+type terminal struct {
+	master *os.File
+	slave  *os.File
+}
+
+// compileExpect compiles the patterns of the expect steps
+func compileExpect(steps []ExpectStep) ([]*regexp.Regexp, error) {
+	patterns := make([]*regexp.Regexp, len(steps))
+	for i, step := range steps {
+		re, err := regexp.Compile(step.Expect)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern of expect step %d: %w", i+1, err)
+		}
+		patterns[i] = re
+	}
+	return patterns, nil
+}
+
+// expecter matches command output against the expect steps
+type expecter struct {
+	mu      sync.Mutex
+	buf     []byte
+	changed chan struct{} // Closed and replaced whenever output arrives
+	done    chan struct{} // Closed once the output has been drained
+}
+
+// newExpecter creates an expecter without output
+func newExpecter() *expecter {
+	return &expecter{changed: make(chan struct{}), done: make(chan struct{})}
+}
+
+// feed adds command output
+func (e *expecter) feed(p []byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.buf = append(e.buf, p...)
+	if len(e.buf) > maxExpectBuffer {
+		e.buf = append(e.buf[:0], e.buf[len(e.buf)-maxExpectBuffer:]...)
+	}
+	close(e.changed)
+	e.changed = make(chan struct{})
+}
+
+// finish reports that no more output will arrive
+func (e *expecter) finish() {
+	close(e.done)
+}
+
+// expect waits until re matches the unconsumed output and consumes it up
+// to the end of the match
+func (e *expecter) expect(re *regexp.Regexp, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		e.mu.Lock()
+		if loc := re.FindIndex(e.buf); loc != nil {
+			e.buf = e.buf[loc[1]:]
+			e.mu.Unlock()
+			return nil
+		}
+		changed := e.changed
+		e.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return fmt.Errorf("timed out after %v waiting for %q", timeout, re)
+		case <-e.done:
+			// Output that arrived last may still match
+			e.mu.Lock()
+			matched := re.Match(e.buf)
+			e.mu.Unlock()
+			if matched {
+				continue
+			}
+			return fmt.Errorf("command finished while waiting for %q", re)
+		}
+	}
+}
+
+// interact runs the expect steps of config against the command's terminal.
+// A failed step terminates the command; the error is returned.
+func (r *commandRun) interact(term *terminal, steps []ExpectStep, patterns []*regexp.Regexp) error {
+	for i, step := range steps {
+		timeout := step.Timeout
+		if timeout <= 0 {
+			timeout = defaultExpectTimeout
+		}
+		if err := r.expecter.expect(patterns[i], timeout); err != nil {
+			r.cancel()
+			return fmt.Errorf("expect step %d: %w", i+1, err)
+		}
+		if step.Send == "" {
+			continue
+		}
+		if _, err := term.master.Write([]byte(step.Send)); err != nil && !errors.Is(err, os.ErrClosed) {
+			r.cancel()
+			return fmt.Errorf("expect step %d: failed to send: %w", i+1, err)
+		}
+	}
+	return nil
+}
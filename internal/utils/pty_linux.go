@@ -0,0 +1,74 @@
+//go:build linux
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// openTerminal allocates a pseudo-terminal pair with the window size of config
+func openTerminal(config *PTYConfig) (*terminal, error) {
+	fd, err := unix.Open("/dev/ptmx", unix.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pseudo-terminal: %w", err)
+	}
+	// Non-blocking, so closing the master interrupts pending reads
+	if err := unix.SetNonblock(fd, true); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("failed to configure pseudo-terminal: %w", err)
+	}
+	master := os.NewFile(uintptr(fd), "/dev/ptmx")
+
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		master.Close()
+		return nil, fmt.Errorf("failed to unlock pseudo-terminal: %w", err)
+	}
+	n, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	if err != nil {
+		master.Close()
+		return nil, fmt.Errorf("failed to get pseudo-terminal number: %w", err)
+	}
+
+	// Set defaults if not specified
+	ws := &unix.Winsize{Row: config.Rows, Col: config.Cols}
+	if ws.Row == 0 {
+		ws.Row = defaultPTYRows
+	}
+	if ws.Col == 0 {
+		ws.Col = defaultPTYCols
+	}
+	if err := unix.IoctlSetWinsize(fd, unix.TIOCSWINSZ, ws); err != nil {
+		master.Close()
+		return nil, fmt.Errorf("failed to set window size: %w", err)
+	}
+
+	slave, err := os.OpenFile("/dev/pts/"+strconv.Itoa(n), os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, fmt.Errorf("failed to open pseudo-terminal: %w", err)
+	}
+	return &terminal{master: master, slave: slave}, nil
+}
+
+// attach makes the terminal the controlling terminal and standard streams
+// of cmd. The command leads a new session instead of a process group; its
+// process group ID is still its pid, so group termination works unchanged.
+func (t *terminal) attach(cmd *exec.Cmd) {
+	cmd.Stdin = t.slave
+	cmd.Stdout = t.slave
+	cmd.Stderr = t.slave
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = false
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+	cmd.SysProcAttr.Ctty = 0 // Standard input of the child
+}
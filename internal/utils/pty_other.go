@@ -0,0 +1,16 @@
+//go:build !linux
+
+package utils
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// openTerminal is only supported on Linux
+func openTerminal(config *PTYConfig) (*terminal, error) {
+	return nil, fmt.Errorf("pseudo-terminals are not supported on %s", runtime.GOOS)
+}
+
+func (t *terminal) attach(cmd *exec.Cmd) {}
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestExecuteCommandPTY tests that the command runs on a terminal with the
+// configured window size
+func TestExecuteCommandPTY(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("Skipping test on %s platform, expect: linux", runtime.GOOS)
+	}
+	defaultLooker = &MockUserLooker{}
+
+	result, err := ExecuteCommand(CommandConfig{
+		Command: "sh",
+		Args:    []string{"-c", "test -t 0 && test -t 1 && test -t 2 && echo tty; stty size; echo err >&2"},
+		PTY:     &PTYConfig{Rows: 30, Cols: 100},
+	})
+	if err != nil {
+		t.Fatalf("ExecuteCommand() error = %v, output: %q", err, result.Output)
+	}
+
+	// The terminal translates newlines
+	want := "tty\r\n30 100\r\nerr\r\n"
+	if string(result.Output) != want || string(result.Stdout) != want {
+		t.Errorf("Output = %q, want %q", result.Output, want)
+	}
+	if len(result.Stderr) != 0 {
+		t.Errorf("Stderr = %q, want everything on stdout", result.Stderr)
+	}
+}
+
+// TestExecuteCommandPTYExpect tests scripted interactions
+func TestExecuteCommandPTYExpect(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("Skipping test on %s platform, expect: linux", runtime.GOOS)
+	}
+	defaultLooker = &MockUserLooker{}
+	prompt := "printf 'Continue? '; read answer; printf 'Name: '; read name; echo \"done $answer $name\""
+
+	tests := []struct {
+		name        string
+		script      string
+		steps       []ExpectStep
+		timeout     time.Duration
+		wantSuccess bool
+		wantOut     string
+		wantErr     string
+	}{
+		{
+			name:   "Answered prompts",
+			script: prompt,
+			steps: []ExpectStep{
+				{Expect: `Continue\? $`, Send: "yes\n"},
+				{Expect: `Name: `, Send: "job\n"},
+				{Expect: `done yes job`},
+			},
+			wantSuccess: true,
+			wantOut:     "done yes job",
+		},
+		{
+			name:    "Expect timeout",
+			script:  "printf 'Password: '; sleep 5",
+			steps:   []ExpectStep{{Expect: "Username:", Timeout: 200 * time.Millisecond}},
+			wantErr: "expect step 1: timed out after 200ms",
+		},
+		{
+			name:    "Command finished first",
+			script:  "echo bye",
+			steps:   []ExpectStep{{Expect: "bye"}, {Expect: "more"}},
+			wantErr: "expect step 2: command finished",
+		},
+		{
+			name:    "Command timeout",
+			script:  "sleep 5",
+			steps:   []ExpectStep{{Expect: "never", Timeout: time.Minute}},
+			timeout: 200 * time.Millisecond,
+			wantErr: "command timed out after 200ms",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			result, err := ExecuteCommand(CommandConfig{
+				Command:     "sh",
+				Args:        []string{"-c", tt.script},
+				Timeout:     tt.timeout,
+				GracePeriod: 100 * time.Millisecond,
+				PTY:         &PTYConfig{Expect: tt.steps},
+			})
+			if result == nil {
+				t.Fatalf("ExecuteCommand() error = %v", err)
+			}
+			if result.Successful != tt.wantSuccess {
+				t.Errorf("Successful = %v, want %v (error %v, output %q)", result.Successful, tt.wantSuccess, err, result.Output)
+			}
+			if tt.wantOut != "" && !strings.Contains(string(result.Output), tt.wantOut) {
+				t.Errorf("Output = %q, want %q", result.Output, tt.wantOut)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("ExecuteCommand() error = %v, want %q", err, tt.wantErr)
+			}
+			if elapsed := time.Since(start); elapsed > 3*time.Second {
+				t.Errorf("ExecuteCommand() took %v", elapsed)
+			}
+		})
+	}
+}
+
+// TestExecuteCommandPTYInvalid tests rejected terminal configurations
+func TestExecuteCommandPTYInvalid(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	tests := []struct {
+		name    string
+		config  CommandConfig
+		wantErr string
+	}{
+		{"Stdin", CommandConfig{Command: "cat", StdinData: []byte("x"), PTY: &PTYConfig{}}, "pseudo-terminal"},
+		{"Invalid pattern", CommandConfig{Command: "true", PTY: &PTYConfig{Expect: []ExpectStep{{Expect: "("}}}}, "invalid pattern of expect step 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ExecuteCommand(tt.config)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ExecuteCommand() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+// RetryPolicy controls re-execution of failed command attempts
+type RetryPolicy struct {
+	MaxAttempts    int           // Total number of attempts including the first (0 or 1: no retries)
+	InitialBackoff time.Duration // Delay before the second attempt (default: 1s)
+	MaxBackoff     time.Duration // Upper bound of the delay between attempts (default: 30s)
+	Multiplier     float64       // Growth factor of the delay per attempt (default: 2)
+	Jitter         float64       // Random deviation as a fraction of the delay, 0 to 1 (optional)
+	RetryExitCodes []int         // Exit codes that are retried; empty retries any failed attempt that exited
+	RetryOnTimeout bool          // Whether attempts that timed out, in total or idle, are retried
+}
+
+// AttemptRecord describes one attempt of a command
+type AttemptRecord struct {
+	Attempt      int           `json:"attempt"`           // Attempt number, starting at 1
+	StartTime    time.Time     `json:"start_time"`        // When the process was started
+	EndTime      time.Time     `json:"end_time"`          // When the process was reaped
+	ExitCode     int           `json:"exit_code"`         // Exit code, -1 if not started or killed by a signal
+	Signal       string        `json:"signal,omitempty"`  // Terminating signal name (if any)
+	TimedOut     bool          `json:"timed_out"`         // Whether the attempt timed out
+	IdleTimedOut bool          `json:"idle_timed_out"`    // Whether the attempt produced no output within IdleTimeout
+	Error        string        `json:"error,omitempty"`   // Execution error message (if any)
+	Backoff      time.Duration `json:"backoff,omitempty"` // Delay before the next attempt (0 for the last)
+
+	OutputFile string `json:"output_file,omitempty"` // File holding the complete combined output of the attempt (SpillDir)
+}
+
+// newAttemptRecord summarises the result of an attempt
+func newAttemptRecord(attempt int, result *CommandResult) AttemptRecord {
+	record := AttemptRecord{
+		Attempt:      attempt,
+		StartTime:    result.StartTime,
+		EndTime:      result.EndTime,
+		ExitCode:     result.ExitCode,
+		Signal:       result.Signal,
+		TimedOut:     result.TimedOut,
+		IdleTimedOut: result.IdleTimedOut,
+		OutputFile:   result.OutputFile,
+	}
+	if result.ExecError != nil {
+		record.Error = result.ExecError.Error()
+	}
+	return record
+}
+
+// shouldRetry reports whether a failed attempt qualifies for another one.
+// Successful, cancelled and never started attempts are not retried.
+func (p RetryPolicy) shouldRetry(result *CommandResult) bool {
+	switch {
+	case result.Successful || result.Canceled || result.StartTime.IsZero():
+		return false
+	case result.TimedOut || result.IdleTimedOut:
+		return p.RetryOnTimeout
+	case result.ExitCode < 0:
+		return false // Killed by a signal
+	case len(p.RetryExitCodes) == 0:
+		return true // Failed by exit code or output
+	default:
+		return slices.Contains(p.RetryExitCodes, result.ExitCode)
+	}
+}
+
+// backoff returns the delay after the given attempt: exponential growth
+// from InitialBackoff, capped at MaxBackoff, with optional jitter
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	// Set defaults if not specified
+	initial := p.InitialBackoff
+	if initial <= 0 {
+		initial = time.Second
+	}
+	maxBackoff := p.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 30 * time.Second
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	delay := float64(initial) * math.Pow(multiplier, float64(attempt-1))
+	if jitter := math.Min(p.Jitter, 1); jitter > 0 {
+		delay += delay * jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(math.Min(delay, float64(maxBackoff)))
+}
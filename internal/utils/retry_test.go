@@ -0,0 +1,247 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// counterScript increments a counter file and exits with the given code
+// until the counter reaches succeedAt
+func counterScript(counter string, failCode string, succeedAt string) []string {
+	return []string{"-c", `n=$(cat "$0" 2>/dev/null || echo 0); n=$((n+1)); echo $n > "$0"; echo attempt $n; [ $n -ge ` + succeedAt + ` ] || exit ` + failCode, counter}
+}
+
+// TestRetryUntilSuccess tests that failed attempts are retried and recorded
+func TestRetryUntilSuccess(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+	counter := filepath.Join(t.TempDir(), "counter")
+
+	result, err := ExecuteCommand(CommandConfig{
+		Command: "sh",
+		Args:    counterScript(counter, "3", "3"),
+		Retry: RetryPolicy{
+			MaxAttempts:    5,
+			InitialBackoff: 10 * time.Millisecond,
+		},
+	})
+	if err != nil || !result.Successful {
+		t.Fatalf("ExecuteCommand() error = %v, successful = %v", err, result.Successful)
+	}
+	if string(result.Output) != "attempt 3\n" {
+		t.Errorf("Output = %q, want output of the last attempt", result.Output)
+	}
+	if len(result.Attempts) != 3 {
+		t.Fatalf("len(Attempts) = %d, want 3", len(result.Attempts))
+	}
+	for i, a := range result.Attempts[:2] {
+		if a.Attempt != i+1 || a.ExitCode != 3 || a.Error == "" || a.Backoff == 0 {
+			t.Errorf("Attempts[%d] = %+v, want failed attempt with backoff", i, a)
+		}
+	}
+	if last := result.Attempts[2]; last.ExitCode != 0 || last.Error != "" || last.Backoff != 0 {
+		t.Errorf("Attempts[2] = %+v, want successful attempt without backoff", last)
+	}
+}
+
+// TestRetrySpillFiles tests that the spill file of every attempt is recorded
+func TestRetrySpillFiles(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+	dir := t.TempDir()
+
+	result, err := ExecuteCommand(CommandConfig{
+		Command:  "sh",
+		Args:     counterScript(filepath.Join(dir, "counter"), "1", "2"),
+		SpillDir: dir,
+		Retry:    RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("ExecuteCommand() error = %v", err)
+	}
+	if len(result.Attempts) != 2 {
+		t.Fatalf("len(Attempts) = %d, want 2", len(result.Attempts))
+	}
+	for i, a := range result.Attempts {
+		data, err := os.ReadFile(a.OutputFile)
+		if want := fmt.Sprintf("attempt %d\n", i+1); err != nil || string(data) != want {
+			t.Errorf("Attempts[%d] output file = %q (error %v), want %q", i, data, err, want)
+		}
+	}
+	if result.OutputFile != result.Attempts[1].OutputFile {
+		t.Errorf("OutputFile = %q, want the file of the last attempt", result.OutputFile)
+	}
+}
+
+// TestRetryConditions tests which failures are retried
+func TestRetryConditions(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	tests := []struct {
+		name         string
+		failCode     string
+		policy       RetryPolicy
+		timeout      time.Duration
+		args         []string
+		success      SuccessRules
+		wantAttempts int
+	}{
+		{
+			name:         "No policy",
+			failCode:     "1",
+			policy:       RetryPolicy{},
+			wantAttempts: 1,
+		},
+		{
+			name:         "Attempts exhausted",
+			failCode:     "1",
+			policy:       RetryPolicy{MaxAttempts: 2},
+			wantAttempts: 2,
+		},
+		{
+			name:         "Retryable exit code",
+			failCode:     "75",
+			policy:       RetryPolicy{MaxAttempts: 3, RetryExitCodes: []int{75}},
+			wantAttempts: 3,
+		},
+		{
+			name:         "Exit code not retryable",
+			failCode:     "1",
+			policy:       RetryPolicy{MaxAttempts: 3, RetryExitCodes: []int{75}},
+			wantAttempts: 1,
+		},
+		{
+			name:         "Timeout not retried by default",
+			policy:       RetryPolicy{MaxAttempts: 3},
+			timeout:      100 * time.Millisecond,
+			args:         []string{"-c", "sleep 5"},
+			wantAttempts: 1,
+		},
+		{
+			name:         "Timeout retried",
+			policy:       RetryPolicy{MaxAttempts: 2, RetryOnTimeout: true},
+			timeout:      100 * time.Millisecond,
+			args:         []string{"-c", "sleep 5"},
+			wantAttempts: 2,
+		},
+		{
+			name:         "Failure pattern retried",
+			policy:       RetryPolicy{MaxAttempts: 2},
+			args:         []string{"-c", "echo 'ERROR: try again'"},
+			success:      SuccessRules{FailurePatterns: []OutputPattern{{Pattern: `ERROR`}}},
+			wantAttempts: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.policy.InitialBackoff = 10 * time.Millisecond
+			args := tt.args
+			if args == nil {
+				args = counterScript(filepath.Join(t.TempDir(), "counter"), tt.failCode, "100")
+			}
+
+			result, err := ExecuteCommand(CommandConfig{
+				Command:     "sh",
+				Args:        args,
+				Timeout:     tt.timeout,
+				GracePeriod: 100 * time.Millisecond,
+				Retry:       tt.policy,
+				Success:     tt.success,
+			})
+			if err == nil || result.Successful {
+				t.Fatalf("ExecuteCommand() error = %v, want failure", err)
+			}
+			if len(result.Attempts) != tt.wantAttempts {
+				t.Errorf("len(Attempts) = %d, want %d", len(result.Attempts), tt.wantAttempts)
+			}
+			if tt.timeout > 0 && (!result.TimedOut || !result.Attempts[0].TimedOut) {
+				t.Errorf("TimedOut = %v, want true", result.TimedOut)
+			}
+		})
+	}
+}
+
+// TestRetryBackoff tests exponential growth, the cap and jitter bounds
+func TestRetryBackoff(t *testing.T) {
+	policy := RetryPolicy{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     3,
+	}
+	want := []time.Duration{100 * time.Millisecond, 300 * time.Millisecond, 900 * time.Millisecond, time.Second}
+	for i, w := range want {
+		if got := policy.backoff(i + 1); got != w {
+			t.Errorf("backoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+
+	if got := (RetryPolicy{}).backoff(2); got != 2*time.Second {
+		t.Errorf("default backoff(2) = %v, want 2s", got)
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		got := policy.backoff(2)
+		if got < 150*time.Millisecond || got > 450*time.Millisecond {
+			t.Fatalf("backoff(2) with jitter = %v, want within [150ms, 450ms]", got)
+		}
+	}
+}
+
+// TestRetryCancelDuringBackoff tests that cancellation stops pending retries
+func TestRetryCancelDuringBackoff(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	start := time.Now()
+	result, err := ExecuteCommandContext(ctx, CommandConfig{
+		Command: "sh",
+		Args:    []string{"-c", "exit 1"},
+		Retry:   RetryPolicy{MaxAttempts: 5, InitialBackoff: 10 * time.Second},
+	})
+	if err == nil {
+		t.Fatal("ExecuteCommandContext() error = nil, want failure")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Cancel took %v, want the backoff to be interrupted", elapsed)
+	}
+	if len(result.Attempts) != 1 {
+		t.Errorf("len(Attempts) = %d, want 1", len(result.Attempts))
+	}
+	if !result.Canceled {
+		t.Error("Canceled = false, want true")
+	}
+	if !errors.Is(err, context.Canceled) || result.ExecError != err {
+		t.Errorf("ExecuteCommandContext() error = %v, ExecError = %v, want context.Canceled", err, result.ExecError)
+	}
+}
+
+// TestRetryDeadlineDuringBackoff tests that the context's deadline ends the
+// backoff and times the command out
+func TestRetryDeadlineDuringBackoff(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	result, err := ExecuteCommandContext(ctx, CommandConfig{
+		Command: "sh",
+		Args:    []string{"-c", "exit 1"},
+		Retry:   RetryPolicy{MaxAttempts: 5, InitialBackoff: 10 * time.Second},
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ExecuteCommandContext() error = %v, want context.DeadlineExceeded", err)
+	}
+	if !result.TimedOut || result.Canceled {
+		t.Errorf("TimedOut = %v, Canceled = %v, want true, false", result.TimedOut, result.Canceled)
+	}
+	if len(result.Attempts) != 1 {
+		t.Errorf("len(Attempts) = %d, want 1", len(result.Attempts))
+	}
+}
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"errors"
+	"syscall"
+)
+
+// ErrSandboxUnavailable is returned when a command cannot be confined to
+// namespaces, e.g. because the kernel lacks support or the caller lacks
+// the privileges to create them
+var ErrSandboxUnavailable = errors.New("namespace sandbox unavailable")
+
+// defaultSandboxHostname is the host name inside the UTS namespace
+const defaultSandboxHostname = "sandbox"
+
+// SandboxConfig runs a command in new mount, PID, UTS and IPC namespaces,
+// and a network namespace with only a loopback interface unless Network is
+// set. The command sees the host's file system read-only and without
+// device nodes, with a writable scratch directory at /tmp, a /dev holding
+// only null, zero, full, random, urandom and tty, an empty /run hiding the
+// host's sockets and a /proc showing only its own processes.
+// It runs without capabilities and cannot gain any, even as root, so it
+// cannot remount the file system. Processes it leaves behind are killed
+// when it exits.
+type SandboxConfig struct {
+	Network       bool   // Share the host's network instead of an isolated loopback-only one
+	UserNamespace bool   // Run as root of a user namespace mapped to the caller, needs no privileges; excludes User and Group
+	ScratchDir    string // Existing host directory mounted writable at /tmp (default: a temporary directory removed afterwards)
+	Hostname      string // Host name inside the sandbox (default: "sandbox")
+}
+
+// sandboxSpec is passed to the sandbox helper process, which sets up the
+// namespaces and then runs the command
+type sandboxSpec struct {
+	Path       string              // Executable of the command
+	Args       []string            // Arguments of the command including argv[0]
+	Dir        string              // Working directory of the command (optional)
+	Cwd        string              // Working directory of the caller, inherited when Dir is empty
+	Root       string              // Mount point of the read-only root
+	Scratch    string              // Host directory mounted at /tmp
+	Hostname   string              // Host name of the UTS namespace
+	Network    bool                // Whether the host's network is shared
+	Credential *syscall.Credential // User and groups of the command (optional)
+}
+
+// sandboxReport is a message of the sandbox helper to the calling process
+type sandboxReport struct {
+	Ready       bool   `json:"ready,omitempty"`       // The namespaces are set up
+	Started     bool   `json:"started,omitempty"`     // The command was started
+	Error       string `json:"error,omitempty"`       // Setup or start failure
+	Unavailable bool   `json:"unavailable,omitempty"` // Whether Error means the sandbox is unavailable
+	Status      *int   `json:"status,omitempty"`      // Wait status of the finished command
+}
@@ -0,0 +1,513 @@
+//go:build linux
+
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// The sandbox helper is this executable, re-executed with sandboxArg0 and
+// the spec in sandboxEnv
+const (
+	sandboxArg0 = "gojob-sandbox"
+	sandboxEnv  = "GOJOB_SANDBOX_SPEC"
+)
+
+// File descriptors of the pipes between the calling process and the helper
+const (
+	sandboxControlFd = 3 // Closed by the caller to let the helper start the command
+	sandboxReportFd  = 4 // Messages of the helper to the caller
+)
+
+// sandbox confines a command run to namespaces. The command is started by
+// a helper process that is the init process of the PID namespace: it sets
+// up the mounts, starts the command once the caller has applied its limits
+// and reports the command's wait status.
+type sandbox struct {
+	config     SandboxConfig
+	base       string   // Private directory holding the mount point of the root
+	scratch    string   // Host directory mounted at /tmp
+	ownScratch bool     // Whether scratch is removed with the sandbox
+	control    *os.File // Caller's end of the control pipe
+	report     *os.File // Caller's end of the report pipe
+	decoder    *json.Decoder
+	childEnds  []*os.File // Helper's ends of the pipes, closed once it started
+}
+
+// init turns the process into the sandbox helper when it was re-executed
+// for a sandboxed command, and never returns in that case
+func init() {
+	if encoded, ok := os.LookupEnv(sandboxEnv); ok && len(os.Args) == 1 && os.Args[0] == sandboxArg0 {
+		os.Exit(runSandbox(encoded))
+	}
+}
+
+// newSandbox creates the directories of a sandbox for config
+func newSandbox(config CommandConfig) (*sandbox, error) {
+	s := &sandbox{config: *config.Sandbox}
+	if s.config.UserNamespace && (config.User != "" || config.Group != "") {
+		return nil, errors.New("a sandbox with a user namespace cannot run as another user or group")
+	}
+	if s.config.ScratchDir != "" {
+		info, err := os.Stat(s.config.ScratchDir)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sandbox scratch directory: %w", err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("invalid sandbox scratch directory: %s is not a directory", s.config.ScratchDir)
+		}
+	}
+
+	base, err := os.MkdirTemp("", "gojob-sandbox-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sandbox directory: %w", err)
+	}
+	s.base = base
+	if err := os.Mkdir(filepath.Join(base, "root"), 0700); err != nil {
+		s.remove()
+		return nil, fmt.Errorf("failed to create sandbox directory: %w", err)
+	}
+
+	s.scratch = s.config.ScratchDir
+	if s.scratch == "" {
+		// Writable by any user like /tmp, as the command may run as User
+		s.scratch = filepath.Join(base, "scratch")
+		s.ownScratch = true
+		if err := os.Mkdir(s.scratch, 0700); err != nil {
+			s.remove()
+			return nil, fmt.Errorf("failed to create sandbox scratch directory: %w", err)
+		}
+		if err := os.Chmod(s.scratch, os.ModeSticky|0777); err != nil {
+			s.remove()
+			return nil, fmt.Errorf("failed to create sandbox scratch directory: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// inside returns the path under which the command sees path, which must
+// be in the scratch directory
+func (s *sandbox) inside(path string) string {
+	rel, err := filepath.Rel(s.scratch, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return filepath.Join("/tmp", rel)
+}
+
+// wrap changes cmd to start the sandbox helper, which runs the original
+// command inside the namespaces
+func (s *sandbox) wrap(cmd *exec.Cmd) error {
+	if cmd.Err != nil {
+		return nil // Start reports the failed lookup
+	}
+
+	spec := sandboxSpec{
+		Path:     cmd.Path,
+		Args:     cmd.Args,
+		Dir:      cmd.Dir,
+		Root:     filepath.Join(s.base, "root"),
+		Scratch:  s.scratch,
+		Hostname: s.config.Hostname,
+		Network:  s.config.Network,
+	}
+	if spec.Dir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get working directory: %w", err)
+		}
+		spec.Cwd = wd
+	}
+	if spec.Hostname == "" {
+		spec.Hostname = defaultSandboxHostname
+	}
+
+	// The helper needs its privileges to set up the namespaces, the command
+	// gets the credential when the helper starts it
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	attr := cmd.SysProcAttr
+	spec.Credential, attr.Credential = attr.Credential, nil
+
+	encoded, err := json.Marshal(spec)
+	if err != nil {
+		return fmt.Errorf("failed to encode sandbox spec: %w", err)
+	}
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+
+	attr.Cloneflags = unix.CLONE_NEWNS | unix.CLONE_NEWPID | unix.CLONE_NEWUTS | unix.CLONE_NEWIPC
+	if !s.config.Network {
+		attr.Cloneflags |= unix.CLONE_NEWNET
+	}
+	if s.config.UserNamespace {
+		attr.Cloneflags |= unix.CLONE_NEWUSER
+		attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Geteuid(), Size: 1}}
+		attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getegid(), Size: 1}}
+	}
+
+	controlR, controlW, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to create sandbox pipe: %w", err)
+	}
+	reportR, reportW, err := os.Pipe()
+	if err != nil {
+		controlR.Close()
+		controlW.Close()
+		return fmt.Errorf("failed to create sandbox pipe: %w", err)
+	}
+	s.control, s.report = controlW, reportR
+	s.decoder = json.NewDecoder(reportR)
+	s.childEnds = []*os.File{controlR, reportW}
+
+	cmd.Path = "/proc/self/exe"
+	cmd.Args = []string{sandboxArg0}
+	cmd.Env = append(env[:len(env):len(env)], sandboxEnv+"="+string(encoded))
+	cmd.Dir = ""
+	cmd.ExtraFiles = s.childEnds
+	return nil
+}
+
+// setUp is called after the helper was started and waits for it to set up
+// the namespaces. Failures are reported with ErrSandboxUnavailable when the
+// kernel or the caller's privileges do not allow the sandbox.
+func (s *sandbox) setUp(cmd *exec.Cmd, startErr error) error {
+	for _, f := range s.childEnds {
+		f.Close()
+	}
+	if startErr != nil {
+		var errno syscall.Errno
+		if !errors.As(startErr, &errno) {
+			return startErr
+		}
+		switch {
+		case errno == syscall.EPERM && !s.config.UserNamespace:
+			return fmt.Errorf("%w: creating namespaces requires CAP_SYS_ADMIN, set UserNamespace to run unprivileged: %w", ErrSandboxUnavailable, startErr)
+		case errno == syscall.EPERM, errno == syscall.ENOSPC, errno == syscall.EUSERS:
+			return fmt.Errorf("%w: user namespaces are disabled or exhausted: %w", ErrSandboxUnavailable, startErr)
+		case errno == syscall.EINVAL, errno == syscall.ENOSYS:
+			return fmt.Errorf("%w: the kernel does not support the namespaces: %w", ErrSandboxUnavailable, startErr)
+		}
+		return startErr
+	}
+
+	report, err := s.receive()
+	if err == nil && !report.Ready {
+		err = errors.New(report.Error)
+		if report.Unavailable {
+			err = fmt.Errorf("%w: %w", ErrSandboxUnavailable, err)
+		}
+	}
+	if err != nil {
+		cmd.Wait()
+		return err
+	}
+	return nil
+}
+
+// release lets the helper start the command, which inherits the limits the
+// caller applied to the helper in between, and waits for the start
+func (s *sandbox) release(cmd *exec.Cmd, startErr error) error {
+	s.control.Close()
+	if startErr != nil {
+		return startErr
+	}
+
+	report, err := s.receive()
+	if err == nil && !report.Started {
+		err = fmt.Errorf("failed to start command in sandbox: %s", report.Error)
+	}
+	if err != nil {
+		cmd.Wait()
+		return err
+	}
+	return nil
+}
+
+// finish completes result with the command's wait status reported by the
+// helper and returns the error describing it; waitErr is the error of the
+// helper's exit, which is kept if no status was reported
+func (s *sandbox) finish(result *CommandResult, waitErr error) error {
+	report, err := s.receive()
+	if err != nil || report.Status == nil {
+		return waitErr
+	}
+
+	ws := syscall.WaitStatus(*report.Status)
+	switch {
+	case ws.Signaled():
+		result.ExitCode = -1
+		result.Signal = signalName(ws.Signal())
+		return errors.New("signal: " + ws.Signal().String())
+	case ws.ExitStatus() == 0:
+		result.ExitCode = 0
+		result.Signal = ""
+		return nil
+	}
+	// The helper exited with the command's exit code
+	return waitErr
+}
+
+// receive reads the next message of the helper
+func (s *sandbox) receive() (sandboxReport, error) {
+	var report sandboxReport
+	if err := s.decoder.Decode(&report); err != nil {
+		return report, fmt.Errorf("sandbox helper exited unexpectedly: %w", err)
+	}
+	return report, nil
+}
+
+// remove closes the pipes and deletes the sandbox's directories. The mount
+// point is removed without recursion, as it never holds files on the host.
+func (s *sandbox) remove() {
+	for _, f := range append(s.childEnds, s.control, s.report) {
+		if f != nil {
+			f.Close()
+		}
+	}
+	if s.ownScratch {
+		os.RemoveAll(s.scratch)
+	}
+	os.Remove(filepath.Join(s.base, "root"))
+	os.Remove(s.base)
+}
+
+// runSandbox is the sandbox helper. It sets up the namespaces it was
+// started in, runs the command and returns its exit code.
+func runSandbox(encoded string) int {
+	// As the init process of the PID namespace the helper must survive the
+	// signals sent to the command's process group; it exits with the command
+	signal.Notify(make(chan os.Signal, 1))
+
+	syscall.CloseOnExec(sandboxControlFd)
+	syscall.CloseOnExec(sandboxReportFd)
+	control := os.NewFile(sandboxControlFd, "control")
+	report := json.NewEncoder(os.NewFile(sandboxReportFd, "report"))
+	os.Unsetenv(sandboxEnv)
+
+	var spec sandboxSpec
+	if err := json.Unmarshal([]byte(encoded), &spec); err != nil {
+		report.Encode(sandboxReport{Error: fmt.Sprintf("invalid sandbox spec: %v", err)})
+		return 1
+	}
+	if err := enterSandbox(spec); err != nil {
+		report.Encode(sandboxReport{Error: err.Error(), Unavailable: true})
+		return 1
+	}
+	report.Encode(sandboxReport{Ready: true})
+
+	// Inherit the caller's working directory like unsandboxed commands, even
+	// if User could not enter it; it stays / if the scratch directory hides it
+	if spec.Dir == "" {
+		unix.Chdir(spec.Cwd)
+	}
+
+	// The helper keeps its capabilities to start the command as User, the
+	// command never gets any
+	if err := dropPrivileges(); err != nil {
+		report.Encode(sandboxReport{Error: err.Error(), Unavailable: true})
+		return 1
+	}
+
+	// Wait for the caller to apply its limits
+	io.Copy(io.Discard, control)
+	control.Close()
+
+	cmd := &exec.Cmd{
+		Path:   spec.Path,
+		Args:   spec.Args,
+		Dir:    spec.Dir,
+		Env:    os.Environ(),
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+	if spec.Credential != nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: spec.Credential}
+	}
+	if err := cmd.Start(); err != nil {
+		report.Encode(sandboxReport{Error: err.Error()})
+		return 1
+	}
+	report.Encode(sandboxReport{Started: true})
+
+	// Reap orphans until the command itself exits
+	var ws syscall.WaitStatus
+	for {
+		pid, err := syscall.Wait4(-1, &ws, 0, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil || pid == cmd.Process.Pid {
+			break
+		}
+	}
+	status := int(ws)
+	report.Encode(sandboxReport{Status: &status})
+
+	if ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return ws.ExitStatus()
+}
+
+// enterSandbox replaces the root of the helper's mount namespace with a
+// read-only view of the host's root without device nodes, with the scratch
+// directory at /tmp, a minimal /dev, an empty /run hiding the host's
+// sockets and a /proc of the new PID namespace
+func enterSandbox(spec sandboxSpec) error {
+	// Keep the mounts below out of the caller's mount namespace
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("failed to make mounts private: %w", err)
+	}
+	if err := unix.Mount("/", spec.Root, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("failed to bind root file system: %w", err)
+	}
+	attr := &unix.MountAttr{Attr_set: unix.MOUNT_ATTR_RDONLY | unix.MOUNT_ATTR_NOSUID | unix.MOUNT_ATTR_NODEV}
+	if err := unix.MountSetattr(unix.AT_FDCWD, spec.Root, unix.AT_RECURSIVE, attr); err != nil {
+		return fmt.Errorf("failed to make root file system read-only: %w", err)
+	}
+	tmp := filepath.Join(spec.Root, "tmp")
+	if err := unix.Mount(spec.Scratch, tmp, "", unix.MS_BIND, ""); err != nil {
+		return fmt.Errorf("failed to mount scratch directory: %w", err)
+	}
+	attr = &unix.MountAttr{Attr_set: unix.MOUNT_ATTR_NOSUID | unix.MOUNT_ATTR_NODEV}
+	if err := unix.MountSetattr(unix.AT_FDCWD, tmp, 0, attr); err != nil {
+		return fmt.Errorf("failed to mount scratch directory: %w", err)
+	}
+	if err := unix.Mount("proc", filepath.Join(spec.Root, "proc"), "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("failed to mount /proc: %w", err)
+	}
+	if err := mountDev(filepath.Join(spec.Root, "dev")); err != nil {
+		return fmt.Errorf("failed to mount /dev: %w", err)
+	}
+
+	// Hide the host's sockets, which the network namespace does not cover
+	for _, dir := range []string{"run", "var/run"} {
+		path := filepath.Join(spec.Root, dir)
+		if info, err := os.Lstat(path); err != nil || !info.IsDir() {
+			continue // Missing, or a symbolic link to /run
+		}
+		if err := unix.Mount("tmpfs", path, "tmpfs", unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "mode=755"); err != nil {
+			return fmt.Errorf("failed to mount /%s: %w", dir, err)
+		}
+	}
+
+	if err := unix.Sethostname([]byte(spec.Hostname)); err != nil {
+		return fmt.Errorf("failed to set host name: %w", err)
+	}
+	if !spec.Network {
+		if err := enableLoopback(); err != nil {
+			return fmt.Errorf("failed to enable loopback interface: %w", err)
+		}
+	}
+
+	// Switch to the new root and detach the old one
+	if err := unix.Chdir(spec.Root); err != nil {
+		return fmt.Errorf("failed to enter root file system: %w", err)
+	}
+	if err := unix.PivotRoot(".", "."); err != nil {
+		return fmt.Errorf("failed to pivot root file system: %w", err)
+	}
+	if err := unix.Unmount(".", unix.MNT_DETACH); err != nil {
+		return fmt.Errorf("failed to detach host root file system: %w", err)
+	}
+	return unix.Chdir("/")
+}
+
+// dropPrivileges keeps the programs the helper executes from gaining
+// capabilities, even as root of the namespaces: it empties the bounding,
+// inheritable and ambient sets and sets no_new_privs, which also disables
+// setuid executables and file capabilities
+func dropPrivileges() error {
+	for c := 0; ; c++ {
+		err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0)
+		if err == unix.EINVAL {
+			break // Past the last capability of the kernel
+		}
+		if err != nil {
+			return fmt.Errorf("failed to drop capability %d: %w", c, err)
+		}
+	}
+
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capget(&hdr, &data[0]); err != nil {
+		return fmt.Errorf("failed to get capabilities: %w", err)
+	}
+	data[0].Inheritable, data[1].Inheritable = 0, 0
+	if err := unix.Capset(&hdr, &data[0]); err != nil {
+		return fmt.Errorf("failed to clear inheritable capabilities: %w", err)
+	}
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to clear ambient capabilities: %w", err)
+	}
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to set no_new_privs: %w", err)
+	}
+	return nil
+}
+
+// sandboxDevices are the host device nodes available in the sandbox's /dev
+var sandboxDevices = []string{"null", "zero", "full", "random", "urandom", "tty"}
+
+// mountDev mounts a read-only tmpfs at dev holding bind mounts of the
+// sandboxDevices and the usual links to /proc/self/fd
+func mountDev(dev string) error {
+	if err := unix.Mount("tmpfs", dev, "tmpfs", unix.MS_NOSUID|unix.MS_NOEXEC, "mode=755"); err != nil {
+		return err
+	}
+	for _, name := range sandboxDevices {
+		host := filepath.Join("/dev", name)
+		if _, err := os.Stat(host); err != nil {
+			continue
+		}
+		path := filepath.Join(dev, name)
+		if err := os.WriteFile(path, nil, 0666); err != nil {
+			return err
+		}
+		if err := unix.Mount(host, path, "", unix.MS_BIND, ""); err != nil {
+			return fmt.Errorf("failed to bind %s: %w", host, err)
+		}
+	}
+	links := map[string]string{"fd": "/proc/self/fd", "stdin": "/proc/self/fd/0", "stdout": "/proc/self/fd/1", "stderr": "/proc/self/fd/2"}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dev, name)); err != nil {
+			return err
+		}
+	}
+	return unix.Mount("", dev, "", unix.MS_REMOUNT|unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NOEXEC, "")
+}
+
+// enableLoopback brings up the loopback interface of a new network namespace
+func enableLoopback() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	ifr, err := unix.NewIfreq("lo")
+	if err != nil {
+		return err
+	}
+	if err := unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr); err != nil {
+		return err
+	}
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+	return unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifr)
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+
+package utils
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// sandbox is not supported outside Linux
+type sandbox struct {
+	scratch string
+}
+
+// newSandbox always fails outside Linux
+func newSandbox(config CommandConfig) (*sandbox, error) {
+	return nil, fmt.Errorf("%w: not supported on %s", ErrSandboxUnavailable, runtime.GOOS)
+}
+
+func (s *sandbox) inside(path string) string                         { return path }
+func (s *sandbox) wrap(cmd *exec.Cmd) error                          { return nil }
+func (s *sandbox) setUp(cmd *exec.Cmd, startErr error) error         { return startErr }
+func (s *sandbox) release(cmd *exec.Cmd, startErr error) error       { return startErr }
+func (s *sandbox) finish(result *CommandResult, waitErr error) error { return waitErr }
+func (s *sandbox) remove()                                           {}
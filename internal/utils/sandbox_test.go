@@ -0,0 +1,294 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// executeSandboxed runs config and skips the test when namespaces are not
+// available to the caller
+func executeSandboxed(t *testing.T, config CommandConfig) (*CommandResult, error) {
+	t.Helper()
+	result, err := ExecuteCommand(config)
+	if errors.Is(err, ErrSandboxUnavailable) {
+		t.Skipf("Sandbox unavailable: %v", err)
+	}
+	return result, err
+}
+
+// TestExecuteCommandSandbox tests the isolation of a sandboxed command
+func TestExecuteCommandSandbox(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+	script := "hostname; set -- /proc/[0-9]*; echo $#; tail -n +3 /proc/net/dev | cut -d: -f1 | tr -d ' '; " +
+		"touch /etc/gojob-sandbox 2>/dev/null || echo read-only; echo hi > /tmp/f && cat /tmp/f; pwd"
+
+	for _, userns := range []bool{false, true} {
+		name := "Privileged"
+		if userns {
+			name = "User namespace"
+		}
+		t.Run(name, func(t *testing.T) {
+			if !userns && os.Geteuid() != 0 {
+				t.Skip("Creating namespaces requires root")
+			}
+			result, err := executeSandboxed(t, CommandConfig{
+				Command:    "sh",
+				Args:       []string{"-c", script},
+				WorkingDir: "/usr",
+				Sandbox:    &SandboxConfig{UserNamespace: userns, Hostname: "job"},
+			})
+			if err != nil {
+				t.Fatalf("ExecuteCommand() error = %v, output: %s", err, result.Output)
+			}
+
+			// Helper and shell are the only processes
+			want := "job\n2\nlo\nread-only\nhi\n/usr\n"
+			if got := string(result.Output); got != want {
+				t.Errorf("Output = %q, want %q", got, want)
+			}
+			if _, err := os.Stat("/etc/gojob-sandbox"); err == nil {
+				t.Errorf("Sandboxed command wrote to the host's /etc")
+			}
+		})
+	}
+}
+
+// TestExecuteCommandSandboxPrivileges tests that a sandboxed command has no
+// capabilities and cannot make the root file system writable
+func TestExecuteCommandSandboxPrivileges(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+	script := "mount -o remount,rw / 2>/dev/null && echo remounted; test -w /etc && echo writable || echo read-only; " +
+		"grep -E '^Cap(Eff|Prm|Bnd):|^NoNewPrivs:' /proc/self/status | tr -d '\\t'"
+
+	for _, userns := range []bool{false, true} {
+		name := "Privileged"
+		if userns {
+			name = "User namespace"
+		}
+		t.Run(name, func(t *testing.T) {
+			if !userns && os.Geteuid() != 0 {
+				t.Skip("Creating namespaces requires root")
+			}
+			result, err := executeSandboxed(t, CommandConfig{
+				Command: "sh",
+				Args:    []string{"-c", script},
+				Sandbox: &SandboxConfig{UserNamespace: userns},
+			})
+			if err != nil {
+				t.Fatalf("ExecuteCommand() error = %v, output: %s", err, result.Output)
+			}
+
+			want := "read-only\nCapPrm:0000000000000000\nCapEff:0000000000000000\nCapBnd:0000000000000000\nNoNewPrivs:1\n"
+			if got := string(result.Output); got != want {
+				t.Errorf("Output = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// TestExecuteCommandSandboxDevices tests that the command can neither open
+// host device nodes nor reach host sockets
+func TestExecuteCommandSandboxDevices(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("Creating device nodes requires root")
+	}
+	defaultLooker = &MockUserLooker{}
+
+	// A block device node outside /dev and a socket in /run
+	dir, err := os.MkdirTemp("/var/tmp", "gojob-sandbox-test-")
+	if err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	block := filepath.Join(dir, "loop")
+	if err := unix.Mknod(block, unix.S_IFBLK|0600, int(unix.Mkdev(7, 0))); err != nil {
+		t.Skipf("Failed to create block device node: %v", err)
+	}
+	socket := filepath.Join("/run", fmt.Sprintf("gojob-sandbox-test-%d.sock", os.Getpid()))
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Failed to listen on %s: %v", socket, err)
+	}
+	defer listener.Close()
+
+	script := "ls /dev | tr '\\n' ' '; echo; head -c 1 " + block + " >/dev/null 2>&1 || echo no-device; " +
+		"test -S " + socket + " || echo no-socket; test -e /dev/loop0 || echo no-host-dev; " +
+		"head -c 4 /dev/zero | wc -c; echo ok > /dev/null && echo null-writable"
+
+	for _, userns := range []bool{false, true} {
+		name := "Privileged"
+		if userns {
+			name = "User namespace"
+		}
+		t.Run(name, func(t *testing.T) {
+			result, err := executeSandboxed(t, CommandConfig{
+				Command: "sh",
+				Args:    []string{"-c", script},
+				Sandbox: &SandboxConfig{UserNamespace: userns},
+			})
+			if err != nil {
+				t.Fatalf("ExecuteCommand() error = %v, output: %s", err, result.Output)
+			}
+
+			want := "fd full null random stderr stdin stdout tty urandom zero \nno-device\nno-socket\nno-host-dev\n4\nnull-writable\n"
+			if got := string(result.Output); got != want {
+				t.Errorf("Output = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// TestExecuteCommandSandboxOptions tests the scratch directory, network,
+// scripts and credentials
+func TestExecuteCommandSandboxOptions(t *testing.T) {
+	defaultLooker = &MockUserLooker{
+		Users: map[string]*user.User{"nobody": {Uid: "65534", Gid: "65534", Username: "nobody", HomeDir: "/nonexistent"}},
+	}
+	scratch := t.TempDir()
+	os.Chmod(scratch, 0777)
+
+	tests := []struct {
+		name        string
+		root        bool
+		config      CommandConfig
+		want        string
+		wantScratch string
+	}{
+		{
+			name:        "Scratch directory",
+			config:      CommandConfig{Command: "sh", Args: []string{"-c", "echo kept > /tmp/out"}, Sandbox: &SandboxConfig{UserNamespace: true, ScratchDir: scratch}},
+			wantScratch: "kept\n",
+		},
+		{
+			name:   "Host network",
+			config: CommandConfig{Command: "sh", Args: []string{"-c", "test $(grep -c : /proc/net/dev) -gt 1 && echo shared"}, Sandbox: &SandboxConfig{UserNamespace: true, Network: true}},
+			want:   "shared\n",
+		},
+		{
+			name:   "Script",
+			config: CommandConfig{Script: "echo \"$0\" | cut -c1-5; echo \"$1\"", Args: []string{"arg"}, Sandbox: &SandboxConfig{UserNamespace: true}},
+			want:   "/tmp/\narg\n",
+		},
+		{
+			name:   "User",
+			root:   true,
+			config: CommandConfig{Command: "sh", Args: []string{"-c", "id -u; touch /tmp/x && echo writable"}, User: "nobody", Sandbox: &SandboxConfig{}},
+			want:   "65534\nwritable\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.root && os.Geteuid() != 0 {
+				t.Skip("Switching users requires root")
+			}
+			if tt.name == "Host network" {
+				if entries, _ := os.ReadDir("/sys/class/net"); len(entries) < 2 {
+					t.Skip("Host has no network interface besides loopback")
+				}
+			}
+
+			result, err := executeSandboxed(t, tt.config)
+			if err != nil {
+				t.Fatalf("ExecuteCommand() error = %v, output: %s", err, result.Output)
+			}
+			if got := string(result.Output); got != tt.want {
+				t.Errorf("Output = %q, want %q", got, tt.want)
+			}
+			if tt.wantScratch != "" {
+				data, err := os.ReadFile(filepath.Join(scratch, "out"))
+				if err != nil || string(data) != tt.wantScratch {
+					t.Errorf("Scratch file = %q (error %v), want %q", data, err, tt.wantScratch)
+				}
+			}
+		})
+	}
+}
+
+// TestExecuteCommandSandboxStatus tests that exit codes, signals and
+// timeouts of the command are reported rather than those of the helper
+func TestExecuteCommandSandboxStatus(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	tests := []struct {
+		name       string
+		script     string
+		timeout    time.Duration
+		wantCode   int
+		wantSignal string
+		wantErr    string
+	}{
+		{name: "Exit code", script: "exit 3", wantCode: 3, wantErr: "exit status 3"},
+		{name: "Signal", script: "kill -USR1 $$", wantCode: -1, wantSignal: "SIGUSR1", wantErr: "signal: user defined signal 1"},
+		{name: "Timeout", script: "sleep 5", timeout: 200 * time.Millisecond, wantCode: -1, wantSignal: "SIGTERM", wantErr: "timed out"},
+		{name: "Left behind", script: "sleep 5 & echo started", wantCode: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			result, err := executeSandboxed(t, CommandConfig{
+				Command:     "sh",
+				Args:        []string{"-c", tt.script},
+				Timeout:     tt.timeout,
+				GracePeriod: 100 * time.Millisecond,
+				Sandbox:     &SandboxConfig{UserNamespace: true},
+			})
+			if result == nil {
+				t.Fatalf("ExecuteCommand() error = %v", err)
+			}
+			if result.ExitCode != tt.wantCode || result.Signal != tt.wantSignal {
+				t.Errorf("ExitCode = %d, Signal = %q, want %d, %q", result.ExitCode, result.Signal, tt.wantCode, tt.wantSignal)
+			}
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("ExecuteCommand() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("ExecuteCommand() error = %v, want %q", err, tt.wantErr)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("ExecuteCommand() took %v", elapsed)
+			}
+		})
+	}
+}
+
+// TestExecuteCommandSandboxInvalid tests rejected sandbox configurations
+func TestExecuteCommandSandboxInvalid(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("Skipping test on %s platform, expect: linux", runtime.GOOS)
+	}
+	defaultLooker = &MockUserLooker{}
+	file := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(file, nil, 0600)
+
+	tests := []struct {
+		name    string
+		config  CommandConfig
+		wantErr string
+	}{
+		{"User namespace with user", CommandConfig{Command: "true", User: "nobody", Sandbox: &SandboxConfig{UserNamespace: true}}, "cannot run as another user"},
+		{"Missing scratch directory", CommandConfig{Command: "true", Sandbox: &SandboxConfig{ScratchDir: "/nonexistent/gojob"}}, "invalid sandbox scratch directory"},
+		{"Scratch file", CommandConfig{Command: "true", Sandbox: &SandboxConfig{ScratchDir: file}}, "is not a directory"},
+		{"Missing command", CommandConfig{Command: "gojob-nonexistent", Sandbox: &SandboxConfig{UserNamespace: true}}, "executable file not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ExecuteCommand(tt.config)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ExecuteCommand() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
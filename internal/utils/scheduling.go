@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+)
+
+// IOPriorityClass is an I/O scheduling class of ioprio_set(2)
+type IOPriorityClass int
+
+// I/O scheduling classes
+const (
+	IOPriorityNone       IOPriorityClass = iota // Keep the inherited I/O priority
+	IOPriorityRealtime                          // Served first; needs privileges
+	IOPriorityBestEffort                        // Default class of processes
+	IOPriorityIdle                              // Served only when no other process needs the disk
+)
+
+// maxCPU is the highest CPU number accepted for CPUAffinity
+const maxCPU = 1023
+
+// hasScheduling reports whether config sets any scheduling attribute
+func hasScheduling(config CommandConfig) bool {
+	return config.Nice != nil || config.IOClass != IOPriorityNone || len(config.CPUAffinity) > 0
+}
+
+// validateScheduling checks the ranges of the scheduling attributes
+func validateScheduling(config CommandConfig) error {
+	if config.Nice != nil && (*config.Nice < -20 || *config.Nice > 19) {
+		return fmt.Errorf("invalid nice value %d, expect -20 to 19", *config.Nice)
+	}
+	if config.IOClass < IOPriorityNone || config.IOClass > IOPriorityIdle {
+		return fmt.Errorf("invalid I/O priority class %d", config.IOClass)
+	}
+	if config.IOLevel < 0 || config.IOLevel > 7 {
+		return fmt.Errorf("invalid I/O priority level %d, expect 0 to 7", config.IOLevel)
+	}
+	if config.IOLevel != 0 && config.IOClass == IOPriorityNone {
+		return errors.New("I/O priority level requires an I/O priority class")
+	}
+	for _, cpu := range config.CPUAffinity {
+		if cpu < 0 || cpu > maxCPU {
+			return fmt.Errorf("invalid CPU %d in CPU affinity", cpu)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+//go:build linux
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"golang.org/x/sys/unix"
+)
+
+// Arguments of ioprio_set(2), which has no wrapper in x/sys
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+)
+
+// startWithScheduling starts cmd from a thread carrying the umask and the
+// scheduling attributes of config. Nice value, I/O priority and CPU
+// affinity are attributes of the thread on Linux, so other goroutines keep
+// running with the caller's.
+func startWithScheduling(cmd *exec.Cmd, config CommandConfig) error {
+	return startOnThread(cmd, func() error {
+		if config.Umask != nil {
+			if err := setThreadUmask(int(*config.Umask & os.ModePerm)); err != nil {
+				return err
+			}
+		}
+		return setThreadScheduling(config)
+	})
+}
+
+// setThreadScheduling applies the scheduling attributes of config to the
+// calling thread
+func setThreadScheduling(config CommandConfig) error {
+	tid := unix.Gettid()
+
+	if config.Nice != nil {
+		if err := unix.Setpriority(unix.PRIO_PROCESS, tid, *config.Nice); err != nil {
+			return fmt.Errorf("failed to set nice value %d: %w", *config.Nice, err)
+		}
+	}
+
+	if config.IOClass != IOPriorityNone {
+		prio := int(config.IOClass)<<ioprioClassShift | config.IOLevel
+		if _, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), uintptr(prio)); errno != 0 {
+			return fmt.Errorf("failed to set I/O priority: %w", errno)
+		}
+	}
+
+	if len(config.CPUAffinity) > 0 {
+		var set unix.CPUSet
+		for _, cpu := range config.CPUAffinity {
+			set.Set(cpu)
+		}
+		if err := unix.SchedSetaffinity(tid, &set); err != nil {
+			return fmt.Errorf("failed to set CPU affinity %v: %w", config.CPUAffinity, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package utils
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// startWithScheduling is only supported on Linux, where scheduling
+// attributes can be set for a single thread
+func startWithScheduling(cmd *exec.Cmd, config CommandConfig) error {
+	return errors.New("scheduling attributes are only supported on Linux")
+}
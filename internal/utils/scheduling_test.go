@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// procStatus returns the nice value from the stat file of a process or
+// thread directory in /proc and the allowed CPUs from its status file
+func procStatus(t *testing.T, dir string) (nice string, cpus string) {
+	t.Helper()
+	stat, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		t.Fatalf("Failed to read stat: %v", err)
+	}
+	// Fields after the command name, which may contain spaces, start with
+	// the state (field 3); the nice value is field 19
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	nice = fields[16]
+
+	status, err := os.ReadFile(filepath.Join(dir, "status"))
+	if err != nil {
+		t.Fatalf("Failed to read status: %v", err)
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		if value, ok := strings.CutPrefix(line, "Cpus_allowed_list:"); ok {
+			cpus = strings.TrimSpace(value)
+		}
+	}
+	return nice, cpus
+}
+
+// TestExecuteCommandScheduling tests nice value, I/O priority and CPU
+// affinity of a started command
+func TestExecuteCommandScheduling(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("Skipping test on %s platform, expect: linux", runtime.GOOS)
+	}
+	defaultLooker = &MockUserLooker{}
+	nice := 7
+	mask := os.FileMode(0077)
+
+	tests := []struct {
+		name     string
+		config   CommandConfig
+		wantNice string
+		wantIO   string
+	}{
+		{
+			name:     "Nice and best effort",
+			config:   CommandConfig{Nice: &nice, IOClass: IOPriorityBestEffort, IOLevel: 6, CPUAffinity: []int{0}},
+			wantNice: "7",
+			wantIO:   "best-effort: prio 6",
+		},
+		{
+			name:     "Idle with umask",
+			config:   CommandConfig{IOClass: IOPriorityIdle, Umask: &mask},
+			wantNice: "0",
+			wantIO:   "idle",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			config.Command = "sleep"
+			config.Args = []string{"5"}
+			h, err := StartCommand(config)
+			if err != nil {
+				t.Fatalf("StartCommand() error = %v", err)
+			}
+			defer h.Wait()
+			defer h.Cancel()
+
+			gotNice, gotCPUs := procStatus(t, fmt.Sprintf("/proc/%d", h.PID()))
+			if gotNice != tt.wantNice {
+				t.Errorf("nice = %s, want %s", gotNice, tt.wantNice)
+			}
+			if len(config.CPUAffinity) > 0 && gotCPUs != "0" {
+				t.Errorf("Cpus_allowed_list = %s, want 0", gotCPUs)
+			}
+			if out, err := exec.Command("ionice", "-p", fmt.Sprint(h.PID())).Output(); err == nil {
+				if got := strings.TrimSpace(string(out)); got != tt.wantIO {
+					t.Errorf("ionice = %q, want %q", got, tt.wantIO)
+				}
+			}
+		})
+	}
+
+	// Commands started later, from any thread, run with default attributes
+	for range 20 {
+		h, err := StartCommand(CommandConfig{Command: "sleep", Args: []string{"5"}})
+		if err != nil {
+			t.Fatalf("StartCommand() error = %v", err)
+		}
+		gotNice, _ := procStatus(t, fmt.Sprintf("/proc/%d", h.PID()))
+		h.Cancel()
+		h.Wait()
+		if gotNice != "0" {
+			t.Fatalf("nice of a later command = %s, want 0", gotNice)
+		}
+	}
+}
+
+// TestExecuteCommandSchedulingInvalid tests rejected scheduling attributes
+func TestExecuteCommandSchedulingInvalid(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("Skipping test on %s platform, expect: linux", runtime.GOOS)
+	}
+	defaultLooker = &MockUserLooker{}
+	highNice, lowNice := 20, -21
+
+	tests := []struct {
+		name    string
+		config  CommandConfig
+		wantErr string
+	}{
+		{"Nice too high", CommandConfig{Nice: &highNice}, "invalid nice value 20"},
+		{"Nice too low", CommandConfig{Nice: &lowNice}, "invalid nice value -21"},
+		{"Invalid class", CommandConfig{IOClass: 4}, "invalid I/O priority class"},
+		{"Invalid level", CommandConfig{IOClass: IOPriorityBestEffort, IOLevel: 8}, "invalid I/O priority level"},
+		{"Level without class", CommandConfig{IOLevel: 3}, "requires an I/O priority class"},
+		{"Negative CPU", CommandConfig{CPUAffinity: []int{-1}}, "invalid CPU -1"},
+		{"Missing CPU", CommandConfig{CPUAffinity: []int{maxCPU}}, "failed to set CPU affinity"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			config.Command = "true"
+			_, err := ExecuteCommand(config)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ExecuteCommand() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// scriptInterpreters maps the supported interpreters to the options they
+// run scripts with: shells abort on the first failing command (like set -e,
+// bash also on failures inside pipelines), python3 writes output unbuffered
+// so it streams like the shells'
+var scriptInterpreters = map[string][]string{
+	"sh":      {"-e"},
+	"bash":    {"-e", "-o", "pipefail"},
+	"python3": {"-u"},
+}
+
+// scriptFile is an inline script written to a private temporary directory
+type scriptFile struct {
+	dir  string
+	path string
+}
+
+// describeCommand returns the command line reported in CommandResult
+func describeCommand(config CommandConfig) string {
+	command := config.Command
+	if config.Script != "" {
+		command = scriptInterpreter(config) + " <script>"
+	}
+	return command + " " + strings.Join(config.Args, " ")
+}
+
+// scriptInterpreter returns the interpreter of config, "sh" by default
+func scriptInterpreter(config CommandConfig) string {
+	if config.Interpreter == "" {
+		return "sh"
+	}
+	return config.Interpreter
+}
+
+// writeScript writes config.Script to a new file readable only by the user
+// running it. The file lives in its own directory with mode 0700, created
+// in parent or the default temporary directory if parent is empty, so no
+// other user can replace it before it is executed.
+func writeScript(config CommandConfig, parent string) (*scriptFile, error) {
+	if config.Command != "" {
+		return nil, fmt.Errorf("command and script are mutually exclusive")
+	}
+	interpreter := scriptInterpreter(config)
+	if _, ok := scriptInterpreters[interpreter]; !ok {
+		return nil, fmt.Errorf("unsupported script interpreter %q", interpreter)
+	}
+
+	dir, err := os.MkdirTemp(parent, "gojob-script-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create script directory: %w", err)
+	}
+	s := &scriptFile{dir: dir, path: filepath.Join(dir, "script")}
+
+	if err := WriteFile(s.path, []byte(config.Script), WriteConfig{
+		Perm: 0700,
+		Flag: os.O_WRONLY | os.O_CREATE | os.O_EXCL,
+		User: config.User,
+	}); err != nil {
+		s.remove()
+		return nil, fmt.Errorf("failed to write script: %w", err)
+	}
+
+	// Hand the directory to the target user as well
+	if config.User != "" {
+		user, err := lookupUser(config.User, defaultLooker)
+		if err != nil {
+			s.remove()
+			return nil, fmt.Errorf("failed to lookup user %s: %w", config.User, err)
+		}
+		// Both IDs were validated by WriteFile
+		uid, _ := strconv.Atoi(user.Uid)
+		gid, _ := strconv.Atoi(user.Gid)
+		if err := os.Chown(dir, uid, gid); err != nil {
+			s.remove()
+			return nil, fmt.Errorf("failed to change owner of script directory: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// apply returns config changed to run the script with its interpreter;
+// Args are passed to the script as its arguments
+func (s *scriptFile) apply(config CommandConfig) CommandConfig {
+	interpreter := scriptInterpreter(config)
+	args := append([]string(nil), scriptInterpreters[interpreter]...)
+	config.Command = interpreter
+	config.Args = append(append(args, s.path), config.Args...)
+	config.Script = ""
+	return config
+}
+
+// remove deletes the script and its directory
+func (s *scriptFile) remove() {
+	os.RemoveAll(s.dir)
+}
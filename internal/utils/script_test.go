@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestExecuteCommandScript tests inline scripts with each interpreter
+func TestExecuteCommandScript(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	tests := []struct {
+		name        string
+		config      CommandConfig
+		wantOut     string
+		wantSuccess bool
+	}{
+		{
+			name: "Multi-line sh script with arguments",
+			config: CommandConfig{
+				Script: "name=$1\necho \"hello $name\"\necho \"$#\"\n",
+				Args:   []string{"world", "two"},
+			},
+			wantOut:     "hello world\n2\n",
+			wantSuccess: true,
+		},
+		{
+			name: "Shell stops at the first failure",
+			config: CommandConfig{
+				Script: "echo before\nfalse\necho after\n",
+			},
+			wantOut:     "before\n",
+			wantSuccess: false,
+		},
+		{
+			name: "Bash pipefail",
+			config: CommandConfig{
+				Script:      "false | true\necho after\n",
+				Interpreter: "bash",
+			},
+			wantOut:     "",
+			wantSuccess: false,
+		},
+		{
+			name: "Python",
+			config: CommandConfig{
+				Script:      "import sys\nprint('args', sys.argv[1:])\n",
+				Interpreter: "python3",
+				Args:        []string{"a"},
+			},
+			wantOut:     "args ['a']\n",
+			wantSuccess: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := exec.LookPath(scriptInterpreter(tt.config)); err != nil {
+				t.Skipf("Interpreter not available: %v", err)
+			}
+
+			result, err := ExecuteCommand(tt.config)
+			if result == nil {
+				t.Fatalf("ExecuteCommand() error = %v", err)
+			}
+			if result.Successful != tt.wantSuccess {
+				t.Errorf("Successful = %v, want %v (error %v)", result.Successful, tt.wantSuccess, err)
+			}
+			if string(result.Output) != tt.wantOut {
+				t.Errorf("Output = %q, want %q", result.Output, tt.wantOut)
+			}
+			if !strings.HasPrefix(result.Command, scriptInterpreter(tt.config)+" <script>") {
+				t.Errorf("Command = %q, want the interpreter and <script>", result.Command)
+			}
+		})
+	}
+}
+
+// TestExecuteCommandScriptCleanup tests that the private script file is
+// removed after the run
+func TestExecuteCommandScriptCleanup(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	result, err := ExecuteCommand(CommandConfig{
+		Script: "echo $0\nstat -c %a $(dirname $0) $0\n",
+	})
+	if err != nil {
+		t.Fatalf("ExecuteCommand() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(result.Output)), "\n")
+	if len(lines) != 3 || lines[1] != "700" || lines[2] != "700" {
+		t.Fatalf("Output = %q, want the script path and 0700 modes", result.Output)
+	}
+	if _, err := os.Stat(filepath.Dir(lines[0])); !os.IsNotExist(err) {
+		t.Errorf("Script directory %s was not removed: %v", filepath.Dir(lines[0]), err)
+	}
+}
+
+// TestExecuteCommandScriptAsUser tests that the script is owned by the user
+// running it
+func TestExecuteCommandScriptAsUser(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("Switching users requires root")
+	}
+	defaultLooker = &MockUserLooker{
+		Users: map[string]*user.User{"nobody": {Uid: "65534", Gid: "65534"}},
+	}
+
+	result, err := ExecuteCommand(CommandConfig{
+		Script: "id -u\nstat -c %u $(dirname $0) $0\n",
+		User:   "nobody",
+	})
+	if err != nil {
+		t.Fatalf("ExecuteCommand() error = %v, output: %s", err, result.Output)
+	}
+	if want := "65534\n65534\n65534\n"; string(result.Output) != want {
+		t.Errorf("Output = %q, want %q", result.Output, want)
+	}
+}
+
+// TestExecuteCommandScriptInvalid tests rejected script configurations
+func TestExecuteCommandScriptInvalid(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	tests := []struct {
+		name    string
+		config  CommandConfig
+		wantErr string
+	}{
+		{"Command and script", CommandConfig{Command: "echo", Script: "echo"}, "mutually exclusive"},
+		{"Unknown interpreter", CommandConfig{Script: "puts 1", Interpreter: "ruby"}, "unsupported script interpreter"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ExecuteCommand(tt.config)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ExecuteCommand() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// stdinFeeder provides the standard input of a command from the Stdin
+// options of its configuration
+type stdinFeeder struct {
+	child  *os.File  // End of the input passed to the child, closed after start
+	writer *os.File  // Parent's end of the pipe (nil when a file is passed directly)
+	source io.Reader // Data copied into the pipe
+}
+
+// validateStdin checks that at most one input source is set and that it
+// can be replayed when the command may be retried
+func validateStdin(config CommandConfig) error {
+	sources := 0
+	if config.StdinData != nil {
+		sources++
+	}
+	if config.StdinFile != "" {
+		sources++
+	}
+	if config.Stdin != nil {
+		sources++
+	}
+	if config.stdinPipe != nil {
+		sources++
+	}
+	if sources > 1 {
+		return errors.New("only one of StdinData, StdinFile and Stdin may be set")
+	}
+	if sources > 0 && config.PTY != nil {
+		return errors.New("stdin cannot be set when running on a pseudo-terminal, use expect steps")
+	}
+	if config.Stdin != nil && config.Retry.MaxAttempts > 1 {
+		return errors.New("stdin reader cannot be replayed for retries, use StdinData or StdinFile")
+	}
+	return nil
+}
+
+// attachStdin connects the configured input to cmd. Files are opened by the
+// calling process, so they only need to be readable by it, not by User.
+// Without input the command reads from the null device as before.
+func attachStdin(cmd *exec.Cmd, config CommandConfig) (*stdinFeeder, error) {
+	if err := validateStdin(config); err != nil {
+		return nil, err
+	}
+
+	f := &stdinFeeder{}
+	switch {
+	case config.stdinPipe != nil:
+		f.child = config.stdinPipe
+	case config.StdinFile != "":
+		file, err := os.Open(config.StdinFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open stdin file: %w", err)
+		}
+		f.child = file
+	case config.StdinData != nil:
+		f.source = bytes.NewReader(config.StdinData)
+	case config.Stdin != nil:
+		f.source = config.Stdin
+	default:
+		return f, nil
+	}
+
+	if f.source != nil {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+		}
+		f.child, f.writer = r, w
+	}
+	cmd.Stdin = f.child
+	return f, nil
+}
+
+// start closes the child's end and begins streaming the input; it must be
+// called after cmd.Start, whether or not the start succeeded. The pipe is
+// closed once the input is exhausted, so the command sees EOF.
+func (f *stdinFeeder) start(started bool) {
+	if f.child != nil {
+		f.child.Close()
+	}
+	if f.writer == nil {
+		return
+	}
+	if !started {
+		f.writer.Close()
+		return
+	}
+
+	go func() {
+		// Errors mean the command stopped reading, e.g. EPIPE after it exited
+		io.Copy(f.writer, f.source)
+		f.writer.Close()
+	}()
+}
+
+// close abandons input the command did not read; it is called after the
+// command was reaped so a blocked write cannot outlive it
+func (f *stdinFeeder) close() {
+	if f.writer != nil {
+		f.writer.Close()
+	}
+}
@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestExecuteCommandStdin tests the stdin sources
+func TestExecuteCommandStdin(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	file := filepath.Join(t.TempDir(), "input")
+	if err := os.WriteFile(file, []byte("from file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		config  CommandConfig
+		wantOut string
+	}{
+		{
+			name:    "No input",
+			config:  CommandConfig{Command: "cat"},
+			wantOut: "",
+		},
+		{
+			name:    "Bytes",
+			config:  CommandConfig{Command: "cat", StdinData: []byte("secret\n")},
+			wantOut: "secret\n",
+		},
+		{
+			name:    "File",
+			config:  CommandConfig{Command: "cat", StdinFile: file},
+			wantOut: "from file\n",
+		},
+		{
+			name:    "Reader",
+			config:  CommandConfig{Command: "cat", Stdin: strings.NewReader("streamed\n")},
+			wantOut: "streamed\n",
+		},
+		{
+			name: "Bytes replayed on retry",
+			config: CommandConfig{
+				Command:   "sh",
+				Args:      []string{"-c", "cat; [ -e \"$0\" ] || { touch \"$0\"; exit 1; }", filepath.Join(t.TempDir(), "marker")},
+				StdinData: []byte("again\n"),
+				Retry:     RetryPolicy{MaxAttempts: 2, InitialBackoff: 10 * time.Millisecond},
+			},
+			wantOut: "again\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ExecuteCommand(tt.config)
+			if err != nil {
+				t.Fatalf("ExecuteCommand() error = %v", err)
+			}
+			if string(result.Output) != tt.wantOut {
+				t.Errorf("Output = %q, want %q", result.Output, tt.wantOut)
+			}
+		})
+	}
+}
+
+// TestExecuteCommandStdinInvalid tests rejected stdin configurations
+func TestExecuteCommandStdinInvalid(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	tests := []struct {
+		name    string
+		config  CommandConfig
+		wantErr string
+	}{
+		{
+			name:    "Several sources",
+			config:  CommandConfig{Command: "cat", StdinData: []byte("a"), StdinFile: "/dev/null"},
+			wantErr: "only one of",
+		},
+		{
+			name:    "Reader with retries",
+			config:  CommandConfig{Command: "cat", Stdin: strings.NewReader("a"), Retry: RetryPolicy{MaxAttempts: 3}},
+			wantErr: "cannot be replayed",
+		},
+		{
+			name:    "Missing file",
+			config:  CommandConfig{Command: "cat", StdinFile: "/nonexistent/input"},
+			wantErr: "failed to open stdin file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ExecuteCommand(tt.config)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ExecuteCommand() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestExecuteCommandStdinUnread tests that input the command never reads
+// does not block completion
+func TestExecuteCommandStdinUnread(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	// A reader that never ends
+	r, w := io.Pipe()
+	defer w.Close()
+	go w.Write([]byte(strings.Repeat("x", 1<<20)))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		result, err := ExecuteCommand(CommandConfig{Command: "true", Stdin: r})
+		if err != nil || !result.Successful {
+			t.Errorf("ExecuteCommand() error = %v", err)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ExecuteCommand() blocked on unread stdin")
+	}
+}
+
+// TestExecuteCommandStdinAsUser tests that the stdin file is opened by the
+// caller, so the target user needs no access to it
+func TestExecuteCommandStdinAsUser(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("Switching users requires root")
+	}
+	defaultLooker = &MockUserLooker{
+		Users: map[string]*user.User{"nobody": {Uid: "65534", Gid: "65534"}},
+	}
+
+	file := filepath.Join(t.TempDir(), "input")
+	if err := os.WriteFile(file, []byte("private\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := ExecuteCommand(CommandConfig{
+		Command:   "sh",
+		Args:      []string{"-c", "id -u; cat"},
+		User:      "nobody",
+		StdinFile: file,
+	})
+	if err != nil {
+		t.Fatalf("ExecuteCommand() error = %v, output: %s", err, result.Output)
+	}
+	if string(result.Output) != "65534\nprivate\n" {
+		t.Errorf("Output = %q, want %q", result.Output, "65534\nprivate\n")
+	}
+}
@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+)
+
+// Rules recorded in CommandResult.DecidedBy
+const (
+	DecidedByExitCode       = "exit_code"
+	DecidedBySuccessPattern = "success_pattern"
+	DecidedByFailurePattern = "failure_pattern"
+)
+
+// SuccessRules decide whether a command that ran to completion succeeded.
+// A matching failure pattern takes precedence over a matching success
+// pattern, which takes precedence over the exit code. Commands that timed
+// out or were cancelled always fail, and success patterns do not apply to
+// processes killed by a signal, the OOM killer or a resource limit. Patterns are matched against the
+// output kept in CommandResult, so MaxOutputBytes may hide matches.
+type SuccessRules struct {
+	ExitCodes       []int           // Exit codes of successful runs (default: 0)
+	SuccessPatterns []OutputPattern // Output forcing success (optional)
+	FailurePatterns []OutputPattern // Output forcing failure (optional)
+}
+
+// OutputPattern is a regular expression matched against command output
+type OutputPattern struct {
+	Stream  string // StreamStdout, StreamStderr, or empty for either
+	Pattern string // Regular expression, e.g. `(?m)^ERROR`
+}
+
+// outputMatcher is a compiled OutputPattern
+type outputMatcher struct {
+	pattern OutputPattern
+	re      *regexp.Regexp
+}
+
+// successDecider applies compiled SuccessRules to finished commands
+type successDecider struct {
+	exitCodes []int
+	success   []outputMatcher
+	failure   []outputMatcher
+}
+
+// compileSuccessRules checks and compiles the patterns of rules
+func compileSuccessRules(rules SuccessRules) (*successDecider, error) {
+	d := &successDecider{exitCodes: rules.ExitCodes}
+	if len(d.exitCodes) == 0 {
+		d.exitCodes = []int{0}
+	}
+
+	var err error
+	if d.success, err = compileOutputPatterns(rules.SuccessPatterns, "success"); err != nil {
+		return nil, err
+	}
+	if d.failure, err = compileOutputPatterns(rules.FailurePatterns, "failure"); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// compileOutputPatterns compiles the patterns of one kind
+func compileOutputPatterns(patterns []OutputPattern, kind string) ([]outputMatcher, error) {
+	matchers := make([]outputMatcher, len(patterns))
+	for i, p := range patterns {
+		if p.Stream != "" && p.Stream != StreamStdout && p.Stream != StreamStderr {
+			return nil, fmt.Errorf("invalid stream %q of %s pattern %d", p.Stream, kind, i+1)
+		}
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s pattern %d: %w", kind, i+1, err)
+		}
+		matchers[i] = outputMatcher{pattern: p, re: re}
+	}
+	return matchers, nil
+}
+
+// decide records the deciding rule in result and returns the error of a
+// failed command, or nil if it succeeded. waitErr is the error of the
+// process's exit.
+func (d *successDecider) decide(result *CommandResult, waitErr error) error {
+	if p, ok := matchOutput(d.failure, result); ok {
+		result.DecidedBy = DecidedByFailurePattern
+		result.MatchedPattern = p.Pattern
+		return fmt.Errorf("output matched failure pattern %q", p.Pattern)
+	}
+	killed := result.Signal != "" || result.OOMKilled || result.LimitExceeded != ""
+	if p, ok := matchOutput(d.success, result); ok && !killed {
+		result.DecidedBy = DecidedBySuccessPattern
+		result.MatchedPattern = p.Pattern
+		return nil
+	}
+
+	result.DecidedBy = DecidedByExitCode
+	if result.Signal != "" || result.ExitCode < 0 {
+		return waitErr
+	}
+	if slices.Contains(d.exitCodes, result.ExitCode) {
+		return nil
+	}
+	if waitErr == nil {
+		return fmt.Errorf("exit status %d is not accepted", result.ExitCode)
+	}
+	return waitErr
+}
+
+// matchOutput returns the first pattern matching the output of result
+func matchOutput(matchers []outputMatcher, result *CommandResult) (OutputPattern, bool) {
+	for _, m := range matchers {
+		switch m.pattern.Stream {
+		case StreamStdout:
+			if m.re.Match(result.Stdout) {
+				return m.pattern, true
+			}
+		case StreamStderr:
+			if m.re.Match(result.Stderr) {
+				return m.pattern, true
+			}
+		default:
+			if m.re.Match(result.Stdout) || m.re.Match(result.Stderr) {
+				return m.pattern, true
+			}
+		}
+	}
+	return OutputPattern{}, false
+}
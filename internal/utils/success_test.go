@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestExecuteCommandSuccessRules tests accepted exit codes, output patterns
+// and their precedence
+func TestExecuteCommandSuccessRules(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	tests := []struct {
+		name        string
+		script      string
+		rules       SuccessRules
+		wantSuccess bool
+		wantDecided string
+		wantPattern string
+		wantErr     string
+	}{
+		{
+			name:        "Default exit code",
+			script:      "exit 1",
+			wantDecided: DecidedByExitCode,
+			wantErr:     "exit status 1",
+		},
+		{
+			name:        "Accepted exit code",
+			script:      "echo 'nothing to do'; exit 1",
+			rules:       SuccessRules{ExitCodes: []int{0, 1}},
+			wantSuccess: true,
+			wantDecided: DecidedByExitCode,
+		},
+		{
+			name:        "Zero not accepted",
+			script:      "exit 0",
+			rules:       SuccessRules{ExitCodes: []int{2}},
+			wantDecided: DecidedByExitCode,
+			wantErr:     "exit status 0 is not accepted",
+		},
+		{
+			name:        "Failure pattern on exit 0",
+			script:      "echo 'ERROR: disk full' >&2",
+			rules:       SuccessRules{FailurePatterns: []OutputPattern{{Stream: StreamStderr, Pattern: `(?m)^ERROR`}}},
+			wantDecided: DecidedByFailurePattern,
+			wantPattern: `(?m)^ERROR`,
+			wantErr:     "output matched failure pattern",
+		},
+		{
+			name:        "Failure pattern on other stream",
+			script:      "echo 'ERROR: disk full'",
+			rules:       SuccessRules{FailurePatterns: []OutputPattern{{Stream: StreamStderr, Pattern: `ERROR`}}},
+			wantSuccess: true,
+			wantDecided: DecidedByExitCode,
+		},
+		{
+			name:        "Success pattern on exit 1",
+			script:      "echo 'already up to date'; exit 1",
+			rules:       SuccessRules{SuccessPatterns: []OutputPattern{{Pattern: `up to date`}}},
+			wantSuccess: true,
+			wantDecided: DecidedBySuccessPattern,
+			wantPattern: `up to date`,
+		},
+		{
+			name:   "Failure pattern before success pattern",
+			script: "echo 'done'; echo 'warning: failed' >&2",
+			rules: SuccessRules{
+				SuccessPatterns: []OutputPattern{{Stream: StreamStdout, Pattern: `done`}},
+				FailurePatterns: []OutputPattern{{Pattern: `failed`}},
+			},
+			wantDecided: DecidedByFailurePattern,
+			wantPattern: `failed`,
+			wantErr:     `output matched failure pattern "failed"`,
+		},
+		{
+			name:        "Signal",
+			script:      "kill -KILL $$",
+			rules:       SuccessRules{ExitCodes: []int{-1, 137}},
+			wantDecided: DecidedByExitCode,
+			wantErr:     "signal: killed",
+		},
+		{
+			name:        "Success pattern on signal",
+			script:      "echo 'already up to date'; kill -TERM $$",
+			rules:       SuccessRules{SuccessPatterns: []OutputPattern{{Pattern: `up to date`}}},
+			wantDecided: DecidedByExitCode,
+			wantErr:     "signal: terminated",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ExecuteCommand(CommandConfig{
+				Command: "sh",
+				Args:    []string{"-c", tt.script},
+				Success: tt.rules,
+			})
+			if result.Successful != tt.wantSuccess || (err == nil) != tt.wantSuccess {
+				t.Errorf("Successful = %v, error = %v, want success %v", result.Successful, err, tt.wantSuccess)
+			}
+			if result.DecidedBy != tt.wantDecided || result.MatchedPattern != tt.wantPattern {
+				t.Errorf("DecidedBy = %q, MatchedPattern = %q, want %q, %q", result.DecidedBy, result.MatchedPattern, tt.wantDecided, tt.wantPattern)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("ExecuteCommand() error = %v, want %q", err, tt.wantErr)
+			}
+			if result.ExecError != err {
+				t.Errorf("ExecError = %v, want %v", result.ExecError, err)
+			}
+		})
+	}
+}
+
+// TestExecuteCommandSuccessRulesTimeout tests that a timeout fails the
+// command even if a success pattern matches
+func TestExecuteCommandSuccessRulesTimeout(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	result, err := ExecuteCommand(CommandConfig{
+		Command:     "sh",
+		Args:        []string{"-c", "echo ok; sleep 5"},
+		Timeout:     200 * time.Millisecond,
+		GracePeriod: 100 * time.Millisecond,
+		Success:     SuccessRules{SuccessPatterns: []OutputPattern{{Pattern: `ok`}}},
+	})
+	if err == nil || result.Successful || !result.TimedOut {
+		t.Errorf("ExecuteCommand() error = %v, Successful = %v, want timeout", err, result.Successful)
+	}
+	if result.DecidedBy != "" {
+		t.Errorf("DecidedBy = %q, want empty", result.DecidedBy)
+	}
+}
+
+// TestExecuteCommandSuccessRulesInvalid tests rejected patterns
+func TestExecuteCommandSuccessRulesInvalid(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	tests := []struct {
+		name    string
+		rules   SuccessRules
+		wantErr string
+	}{
+		{"Invalid success pattern", SuccessRules{SuccessPatterns: []OutputPattern{{Pattern: "("}}}, "invalid success pattern 1"},
+		{"Invalid failure pattern", SuccessRules{FailurePatterns: []OutputPattern{{Pattern: "ok"}, {Pattern: "["}}}, "invalid failure pattern 2"},
+		{"Invalid stream", SuccessRules{FailurePatterns: []OutputPattern{{Stream: "both", Pattern: "x"}}}, `invalid stream "both"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ExecuteCommand(CommandConfig{Command: "true", Success: tt.rules})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ExecuteCommand() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Defaults for graceful termination
+const (
+	defaultGracePeriod = 5 * time.Second
+	waitDelaySlack     = time.Second // Extra time for output pipes to drain after SIGKILL
+)
+
+// groupPollInterval is how often a terminated group whose leader exited is
+// checked for remaining members
+const groupPollInterval = 20 * time.Millisecond
+
+// groupTerminator stops the process group of a command: first with the
+// configured signal, then with SIGKILL once the grace period has elapsed
+type groupTerminator struct {
+	cmd    *exec.Cmd
+	signal syscall.Signal
+	grace  time.Duration
+	cgroup *transientCgroup // Also killed with SIGKILL (optional)
+
+	mu         sync.Mutex
+	timer      *time.Timer
+	killed     chan struct{} // Closed once the grace period has elapsed
+	terminated bool
+}
+
+// newGroupTerminator runs cmd in its own process group and installs the
+// termination sequence as the command's cancel function
+func newGroupTerminator(cmd *exec.Cmd, config CommandConfig) *groupTerminator {
+	t := &groupTerminator{
+		cmd:    cmd,
+		signal: config.KillSignal,
+		grace:  config.GracePeriod,
+	}
+
+	// Set defaults if not specified
+	if t.signal == 0 {
+		t.signal = syscall.SIGTERM
+	}
+	if t.grace <= 0 {
+		t.grace = defaultGracePeriod
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	cmd.Cancel = t.terminate
+	return t
+}
+
+// drainTimeout is how long output is read after the command was reaped;
+// it bounds the wait for processes that escaped the group but hold the pipes
+func (t *groupTerminator) drainTimeout() time.Duration {
+	return t.grace + waitDelaySlack
+}
+
+// terminate signals the process group and schedules the SIGKILL
+func (t *groupTerminator) terminate() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.terminated {
+		return nil
+	}
+	t.terminated = true
+
+	pgid := t.cmd.Process.Pid
+	err := syscall.Kill(-pgid, t.signal)
+	t.killed = make(chan struct{})
+	t.timer = time.AfterFunc(t.grace, func() {
+		t.kill()
+		close(t.killed)
+	})
+
+	if errors.Is(err, syscall.ESRCH) {
+		return os.ErrProcessDone
+	}
+	return err
+}
+
+// finish is called after the command was reaped. If the command was
+// terminated, the remaining members of its group get the rest of the grace
+// period to exit, e.g. to run their cleanup handlers, and are killed then.
+func (t *groupTerminator) finish() {
+	t.mu.Lock()
+	terminated, killed := t.terminated, t.killed
+	t.mu.Unlock()
+	if !terminated {
+		return
+	}
+
+	pgid := t.cmd.Process.Pid
+	for groupAlive(pgid) {
+		select {
+		case <-killed:
+			return
+		case <-time.After(groupPollInterval):
+		}
+	}
+	t.timer.Stop()
+	t.kill()
+}
+
+// kill sends SIGKILL to the process group and every process of the cgroup
+func (t *groupTerminator) kill() {
+	syscall.Kill(-t.cmd.Process.Pid, syscall.SIGKILL)
+	if t.cgroup != nil {
+		t.cgroup.kill()
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package utils
+
+import "syscall"
+
+// groupAlive reports whether the process group pgid has members, including
+// zombies
+func groupAlive(pgid int) bool {
+	return syscall.Kill(-pgid, 0) != syscall.ESRCH
+}
@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// processGone reports whether pid no longer runs (absent or zombie)
+func processGone(pid int) bool {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return syscall.Kill(pid, 0) == syscall.ESRCH
+	}
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) > 0 && fields[0] == "Z"
+}
+
+// TestTimeoutKillsProcessGroup tests that grandchildren do not survive a timeout
+func TestTimeoutKillsProcessGroup(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	result, err := ExecuteCommand(CommandConfig{
+		Command: "sh",
+		Args:    []string{"-c", "sleep 30 & echo $!; wait"},
+		Timeout: 500 * time.Millisecond,
+	})
+	if err == nil || !result.TimedOut {
+		t.Fatalf("Expected timeout, got result %+v err %v", result, err)
+	}
+
+	pid, convErr := strconv.Atoi(strings.TrimSpace(string(result.Stdout)))
+	if convErr != nil {
+		t.Fatalf("Failed to read grandchild pid from %q", result.Stdout)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !processGone(pid) {
+		if time.Now().After(deadline) {
+			syscall.Kill(pid, syscall.SIGKILL)
+			t.Fatalf("Grandchild %d survived the timeout", pid)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if result.Signal != "SIGTERM" {
+		t.Errorf("Signal = %q, want SIGTERM", result.Signal)
+	}
+}
+
+// TestTimeoutGracePeriod tests escalation to SIGKILL after the grace period
+func TestTimeoutGracePeriod(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	start := time.Now()
+	result, err := ExecuteCommand(CommandConfig{
+		Command:     "sh",
+		Args:        []string{"-c", "trap '' TERM; sleep 30"},
+		Timeout:     200 * time.Millisecond,
+		GracePeriod: 300 * time.Millisecond,
+	})
+	elapsed := time.Since(start)
+
+	if err == nil || !result.TimedOut {
+		t.Fatalf("Expected timeout, got result %+v err %v", result, err)
+	}
+	if result.Signal != "SIGKILL" {
+		t.Errorf("Signal = %q, want SIGKILL", result.Signal)
+	}
+	if elapsed < 500*time.Millisecond || elapsed > 3*time.Second {
+		t.Errorf("Command took %v, want timeout plus grace period", elapsed)
+	}
+}
+
+// TestTimeoutGroupGracePeriod tests that members of the group get the grace
+// period after the command itself exited
+func TestTimeoutGroupGracePeriod(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+	marker := filepath.Join(t.TempDir(), "cleaned")
+
+	tests := []struct {
+		name        string
+		script      string
+		grace       time.Duration
+		wantCleaned bool
+		wantMin     time.Duration
+	}{
+		{
+			name:        "Cleanup handler",
+			script:      "sh -c 'trap \"sleep 0.3; touch " + marker + "; exit\" TERM; while :; do sleep 0.05; done' & wait",
+			grace:       5 * time.Second,
+			wantCleaned: true,
+			wantMin:     300 * time.Millisecond,
+		},
+		{
+			name:    "Ignored signal",
+			script:  "(trap '' TERM; sleep 30) & wait",
+			grace:   300 * time.Millisecond,
+			wantMin: 300 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(marker)
+			start := time.Now()
+			result, err := ExecuteCommand(CommandConfig{
+				Command:     "sh",
+				Args:        []string{"-c", tt.script},
+				Timeout:     200 * time.Millisecond,
+				GracePeriod: tt.grace,
+			})
+			elapsed := time.Since(start) - 200*time.Millisecond
+
+			if err == nil || !result.TimedOut {
+				t.Fatalf("Expected timeout, got result %+v err %v", result, err)
+			}
+			if _, err := os.Stat(marker); (err == nil) != tt.wantCleaned {
+				t.Errorf("Cleanup ran = %v, want %v", err == nil, tt.wantCleaned)
+			}
+			if elapsed < tt.wantMin || elapsed > 3*time.Second {
+				t.Errorf("Command took %v after the timeout, want at least %v", elapsed, tt.wantMin)
+			}
+		})
+	}
+}
+
+// TestTimeoutCustomSignal tests a configured termination signal
+func TestTimeoutCustomSignal(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	result, _ := ExecuteCommand(CommandConfig{
+		Command:     "sh",
+		Args:        []string{"-c", "trap 'echo interrupted; exit 130' INT; sleep 30 & wait"},
+		Timeout:     300 * time.Millisecond,
+		KillSignal:  syscall.SIGINT,
+		GracePeriod: 300 * time.Millisecond, // The background sleep ignores SIGINT
+	})
+
+	if !result.TimedOut {
+		t.Fatal("Expected TimedOut to be true")
+	}
+	if !strings.Contains(string(result.Output), "interrupted") || result.ExitCode != 130 {
+		t.Errorf("Expected INT handler to run, got exit %d output %q", result.ExitCode, result.Output)
+	}
+}
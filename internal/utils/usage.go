@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// ResourceUsage holds the resource usage of a finished process
+type ResourceUsage struct {
+	UserCPU   time.Duration `json:"user_cpu"`   // CPU time spent in user mode
+	SystemCPU time.Duration `json:"system_cpu"` // CPU time spent in kernel mode
+	MaxRSS    int64         `json:"max_rss"`    // Peak resident set size in bytes
+	InBlock   int64         `json:"in_block"`   // Block input operations
+	OutBlock  int64         `json:"out_block"`  // Block output operations
+}
+
+// fillProcessState copies exit status, terminating signal and resource
+// usage of a finished process into result
+func fillProcessState(result *CommandResult, state *os.ProcessState) {
+	if state == nil {
+		return
+	}
+
+	result.ExitCode = state.ExitCode()
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		result.Signal = signalName(ws.Signal())
+	}
+
+	ru, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok || ru == nil {
+		return
+	}
+	maxRSS := int64(ru.Maxrss)
+	if runtime.GOOS != "darwin" {
+		maxRSS *= 1024 // Reported in kilobytes everywhere but macOS
+	}
+	result.Usage = &ResourceUsage{
+		UserCPU:   time.Duration(ru.Utime.Nano()),
+		SystemCPU: time.Duration(ru.Stime.Nano()),
+		MaxRSS:    maxRSS,
+		InBlock:   int64(ru.Inblock),
+		OutBlock:  int64(ru.Oublock),
+	}
+}
+
+// signalName returns the name of sig, e.g. "SIGKILL"
+func signalName(sig syscall.Signal) string {
+	if name := unix.SignalName(sig); name != "" {
+		return name
+	}
+	return sig.String()
+}
@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCommandResultExitStatus tests exit code, signal and timing fields
+func TestCommandResultExitStatus(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantSignal string
+	}{
+		{"success", []string{"-c", "exit 0"}, 0, ""},
+		{"exit code", []string{"-c", "exit 3"}, 3, ""},
+		{"signal", []string{"-c", "kill -TERM $$"}, -1, "SIGTERM"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, _ := ExecuteCommand(CommandConfig{Command: "sh", Args: tt.args})
+
+			if result.ExitCode != tt.wantCode {
+				t.Errorf("ExitCode = %d, want %d", result.ExitCode, tt.wantCode)
+			}
+			if result.Signal != tt.wantSignal {
+				t.Errorf("Signal = %q, want %q", result.Signal, tt.wantSignal)
+			}
+			if result.StartTime.IsZero() || result.EndTime.Before(result.StartTime) {
+				t.Errorf("Invalid start/end time: %v - %v", result.StartTime, result.EndTime)
+			}
+			if result.Duration != result.EndTime.Sub(result.StartTime) {
+				t.Errorf("Duration = %v, want end - start", result.Duration)
+			}
+			if result.Usage == nil || result.Usage.MaxRSS <= 0 {
+				t.Errorf("Expected resource usage with MaxRSS, got %+v", result.Usage)
+			}
+		})
+	}
+}
+
+// TestCommandResultNotStarted tests results of commands that failed to start
+func TestCommandResultNotStarted(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	result, err := ExecuteCommand(CommandConfig{Command: "/non-existent-command"})
+	if err == nil {
+		t.Fatal("Expected error, but got nil")
+	}
+	if result.ExitCode != -1 || result.Usage != nil || !result.StartTime.IsZero() {
+		t.Errorf("Unexpected result for command that did not start: %+v", result)
+	}
+}
+
+// TestCommandResultUsage tests that CPU time is reported
+func TestCommandResultUsage(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	result, err := ExecuteCommand(CommandConfig{
+		Command: "sh",
+		Args:    []string{"-c", "i=0; while [ $i -lt 200000 ]; do i=$((i+1)); done"},
+	})
+	if err != nil {
+		t.Fatalf("ExecuteCommand() error = %v", err)
+	}
+	if result.Usage.UserCPU+result.Usage.SystemCPU <= 0 {
+		t.Errorf("Expected CPU time to be reported, got %+v", result.Usage)
+	}
+}
+
+// TestCommandResultJSON tests JSON round trips including the error
+func TestCommandResultJSON(t *testing.T) {
+	defaultLooker = &MockUserLooker{}
+
+	result, _ := ExecuteCommand(CommandConfig{Command: "sh", Args: []string{"-c", "echo hi; exit 2"}})
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	for _, want := range []string{`"exit_code":2`, `"error":"exit status 2"`, `"usage":{"user_cpu":`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("JSON missing %s: %s", want, data)
+		}
+	}
+
+	var decoded CommandResult
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if decoded.ExecError == nil || decoded.ExecError.Error() != "exit status 2" {
+		t.Errorf("ExecError = %v, want exit status 2", decoded.ExecError)
+	}
+	if decoded.ExitCode != 2 || string(decoded.Stdout) != "hi\n" || !decoded.StartTime.Equal(result.StartTime) {
+		t.Errorf("Decoded result mismatch: %+v", decoded)
+	}
+	if decoded.Duration.Round(time.Nanosecond) != result.Duration {
+		t.Errorf("Duration = %v, want %v", decoded.Duration, result.Duration)
+	}
+}